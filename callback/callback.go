@@ -0,0 +1,73 @@
+// Callback package signs and verifies the data of inline keyboard buttons.
+//
+// Telegram clients can send any callback data for a button, so the bot signs the data it puts on buttons
+// and only acts on data with a valid signature. The data is written as "version|action|arguments...|signature".
+// The signature also covers the chat ID, so the data of a button can not be reused in another chat.
+package callback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Version of the callback data format. Buttons with data of other versions are rejected.
+const Version = "1"
+
+// Longest callback data that Telegram accepts, in bytes.
+const MaxLength = 64
+
+// separator separates the fields of the callback data.
+const separator = "|"
+
+// signatureLength is the number of HMAC bytes kept in the signature.
+const signatureLength = 12
+
+var (
+	// ErrInvalid is returned when the callback data is malformed or the signature does not match.
+	ErrInvalid = errors.New("invalid callback data")
+
+	// ErrVersion is returned for callback data of an unsupported version.
+	ErrVersion = errors.New("unsupported callback data version")
+
+	// ErrTooLong is returned when the signed data would not fit on a button.
+	ErrTooLong = errors.New("callback data is too long")
+)
+
+// Sign encodes an action and its arguments for a button in a chat and signs them with the secret.
+func Sign(Secret string, ChatId int64, Action string, Args ...string) (string, error) {
+	payload := strings.Join(append([]string{Version, Action}, Args...), separator)
+	data := payload + separator + signature(Secret, ChatId, payload)
+	if len(data) > MaxLength {
+		return "", ErrTooLong
+	}
+	return data, nil
+}
+
+// Verify checks the signature of the callback data of a button in a chat and returns the action and its arguments.
+func Verify(Secret string, ChatId int64, Data string) (Action string, Args []string, err error) {
+	fields := strings.Split(Data, separator)
+	if fields[0] != Version {
+		return "", nil, ErrVersion
+	}
+	if len(fields) < 3 {
+		return "", nil, ErrInvalid
+	}
+
+	payload := strings.Join(fields[:len(fields)-1], separator)
+	if !hmac.Equal([]byte(fields[len(fields)-1]), []byte(signature(Secret, ChatId, payload))) {
+		return "", nil, ErrInvalid
+	}
+
+	return fields[1], fields[2 : len(fields)-1], nil
+}
+
+// signature computes the truncated HMAC-SHA256 of the chat ID and the payload.
+func signature(Secret string, ChatId int64, payload string) string {
+	mac := hmac.New(sha256.New, []byte(Secret))
+	mac.Write([]byte(strconv.FormatInt(ChatId, 10) + separator + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureLength])
+}
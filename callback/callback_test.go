@@ -0,0 +1,75 @@
+package callback
+
+import (
+	"strings"
+	"testing"
+)
+
+const secret = "bot-token"
+
+func TestSignVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		args   []string
+	}{
+		{"no arguments", "cancel", nil},
+		{"one argument", "unban", []string{"123456789"}},
+		{"several arguments", "confirm", []string{"abc", "-100123"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := Sign(secret, -100123, test.action, test.args...)
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			action, args, err := Verify(secret, -100123, data)
+			if err != nil {
+				t.Fatalf("Verify(%q) error = %v", data, err)
+			}
+			if action != test.action || strings.Join(args, separator) != strings.Join(test.args, separator) {
+				t.Errorf("Verify(%q) = %q, %q; want %q, %q", data, action, args, test.action, test.args)
+			}
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	data, err := Sign(secret, -100123, "unban", "123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Split(data, separator)
+	otherVersion := "2|unban|123456789"
+	otherVersion += separator + signature(secret, -100123, otherVersion)
+
+	tests := []struct {
+		name   string
+		secret string
+		chatId int64
+		data   string
+		want   error
+	}{
+		{"tampered argument", secret, -100123, strings.Replace(data, "123456789", "987654321", 1), ErrInvalid},
+		{"tampered action", secret, -100123, strings.Replace(data, "unban", "ban", 1), ErrInvalid},
+		{"tampered signature", secret, -100123, strings.Join(fields[:len(fields)-1], separator) + separator + "AAAAAAAAAAAAAAAA", ErrInvalid},
+		{"wrong chat ID", secret, -100456, data, ErrInvalid},
+		{"wrong secret", "other-token", -100123, data, ErrInvalid},
+		{"wrong version", secret, -100123, otherVersion, ErrVersion},
+		{"missing signature", secret, -100123, "1|unban", ErrInvalid},
+		{"empty", secret, -100123, "", ErrVersion},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := Verify(test.secret, test.chatId, test.data); err != test.want {
+				t.Errorf("Verify(%q) error = %v; want %v", test.data, err, test.want)
+			}
+		})
+	}
+}
+
+func TestSignTooLong(t *testing.T) {
+	if _, err := Sign(secret, -100123, "confirm", strings.Repeat("a", MaxLength)); err != ErrTooLong {
+		t.Errorf("Sign() error = %v; want %v", err, ErrTooLong)
+	}
+}
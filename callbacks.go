@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"github.com/freshautomations/telegram-moderator-bot/callback"
+	"github.com/freshautomations/telegram-moderator-bot/context"
+	"github.com/freshautomations/telegram-moderator-bot/telegram"
+	"log"
+	"strconv"
+)
+
+// Button actions.
+const (
+	actionUnban   = "unban"
+	actionConfirm = "confirm"
+	actionCancel  = "cancel"
+)
+
+// callbackHandler handles the clicks on the buttons of an action. It returns the answer shown to the user who clicked.
+type callbackHandler struct {
+	// Number of arguments in the callback data
+	Args int
+
+	// Only administrators can click the button, not moderators
+	AdminOnly bool
+
+	Handle func(ctx *context.Context, query *telegram.CallbackQuery, args []string) string
+}
+
+// Callback handlers by button action.
+var callbackHandlers = map[string]callbackHandler{
+	actionUnban:   {Args: 1, Handle: unbanCallback},
+	actionConfirm: {Args: 1, Handle: confirmCallback},
+	actionCancel:  {Args: 1, Handle: cancelCallback},
+}
+
+// ProcessCallbackQuery handles a button click. The callback data has to be signed by the bot and the user who clicked
+// has to be a moderator of the supergroup.
+func ProcessCallbackQuery(ctx *context.Context, query *telegram.CallbackQuery) error {
+	if query.Message == nil || query.Message.Chat == nil {
+		return ctx.Telegram.AnswerCallbackQuery(query.Id, "This button is not supported.", false)
+	}
+	chatId := query.Message.Chat.Id
+
+	action, args, err := callback.Verify(ctx.Cfg.TelegramToken, chatId, query.Data)
+	handler, ok := callbackHandlers[action]
+	if err != nil || !ok || len(args) != handler.Args {
+		log.Printf("[warning] Invalid callback data from %s in %d: %q, %v", query.From, chatId, query.Data, err)
+		return ctx.Telegram.AnswerCallbackQuery(query.Id, "This button has expired.", true)
+	}
+
+	isAdmin, isMod, err := ctx.Telegram.GetPrivileges(chatId, query.From.Id)
+	if err != nil {
+		ctx.Telegram.AnswerCallbackQuery(query.Id, "Could not check user privileges.", true)
+		return err
+	}
+	if !isMod || (handler.AdminOnly && !isAdmin) {
+		return ctx.Telegram.AnswerCallbackQuery(query.Id, "You are not allowed to use this button.", true)
+	}
+
+	return ctx.Telegram.AnswerCallbackQuery(query.Id, handler.Handle(ctx, query, args), false)
+}
+
+// Creates a button that carries a signed action for the chat.
+func callbackButton(ctx *context.Context, ChatId int64, Text string, Action string, Args ...string) (telegram.InlineKeyboardButton, error) {
+	data, err := callback.Sign(ctx.Cfg.TelegramToken, ChatId, Action, Args...)
+	return telegram.InlineKeyboardButton{Text: Text, CallbackData: data}, err
+}
+
+// Creates a keyboard with an Unban button for each user. Returns nil if there are no users.
+func unbanKeyboard(ctx *context.Context, ChatId int64, Users []*telegram.User) *telegram.InlineKeyboardMarkup {
+	if len(Users) == 0 {
+		return nil
+	}
+	keyboard := &telegram.InlineKeyboardMarkup{}
+	for _, user := range Users {
+		button, err := callbackButton(ctx, ChatId, fmt.Sprintf("Unban %s", user.String()), actionUnban, strconv.Itoa(user.Id))
+		if err != nil {
+			log.Printf("[error] unbanKeyboard: %+v, %v", user, err)
+			continue
+		}
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []telegram.InlineKeyboardButton{button})
+	}
+	return keyboard
+}
+
+// Unbans the user of the button and notes it in the message, without the button.
+func unbanCallback(ctx *context.Context, query *telegram.CallbackQuery, args []string) string {
+	chatId := query.Message.Chat.Id
+	userId, _ := strconv.Atoi(args[0])
+
+	member, err := ctx.Telegram.GetChatMember(chatId, userId)
+	if err != nil {
+		return fmt.Sprintf("Could not unban the user: %s.", telegram.Explain(err))
+	}
+	if member.Status != "kicked" {
+		removeButton(ctx, query, fmt.Sprintf("%s is not banned.", member.User.String()))
+		return "The user is not banned."
+	}
+
+	list, errors := UnbanMember(ctx, chatId, []*telegram.User{member.User})
+	if len(list) < 1 {
+		if len(errors) > 0 {
+			return fmt.Sprintf("Could not unban the user: %s.", errors[0])
+		}
+		return "Could not unban the user."
+	}
+
+	log.Printf("[info] Unbanned %+v in %d from a button by %+v.", member.User, chatId, query.From)
+	removeButton(ctx, query, fmt.Sprintf("%s was unbanned by %s.", member.User.String(), query.From.String()))
+	return "Unbanned."
+}
+
+// Removes the clicked button from the message and adds a note to its text.
+func removeButton(ctx *context.Context, query *telegram.CallbackQuery, Note string) {
+	var keyboard *telegram.InlineKeyboardMarkup
+	if query.Message.ReplyMarkup != nil {
+		for _, row := range query.Message.ReplyMarkup.InlineKeyboard {
+			var kept []telegram.InlineKeyboardButton
+			for _, button := range row {
+				if button.CallbackData != query.Data {
+					kept = append(kept, button)
+				}
+			}
+			if len(kept) > 0 {
+				if keyboard == nil {
+					keyboard = &telegram.InlineKeyboardMarkup{}
+				}
+				keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, kept)
+			}
+		}
+	}
+	ctx.Telegram.EditMessageText(query.Message.Chat.Id, query.Message.MessageId, fmt.Sprintf("%s\n%s", query.Message.Text, Note), keyboard)
+}
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"fmt"
+	"github.com/freshautomations/telegram-moderator-bot/context"
+	"github.com/freshautomations/telegram-moderator-bot/db"
+	"github.com/freshautomations/telegram-moderator-bot/defaults"
+	"github.com/freshautomations/telegram-moderator-bot/telegram"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Roles that can use a command. Each role can use the commands of the roles before it.
+const (
+	rolePublic = iota
+	roleModerator
+	roleAdministrator
+)
+
+// Composed help text.
+const textHelpMessage = `Hi %s!
+You are a%s.
+
+Available commands:%s
+
+Instead of _@username_ you can use the numeric user ID or reply to a message of the user.`
+
+// commandArg is an argument of a command, as shown in the help and usage texts.
+type commandArg struct {
+	Name     string
+	Optional bool
+}
+
+// commandHandler declares a command: its names, who can use it, its arguments, its help and the function that runs it.
+type commandHandler struct {
+	Name    string
+	Aliases []string
+
+	// Least role that can use the command
+	Role int
+
+	Args []commandArg
+
+	// Short description without formatting, also used in the Telegram command menu
+	Description string
+
+	// More help after the description. X will be replaced with backtick.
+	Details string
+
+	Handle func(ctx *context.Context, request *commandRequest)
+}
+
+// commandRequest is a command received in a supergroup from a user who can use it.
+type commandRequest struct {
+	Message   *telegram.Message
+	Command   *CommandData
+	ChatId    int64
+	MessageId int64
+	IsAdmin   bool
+	Handler   *commandHandler
+}
+
+// Commands in the order of the help text. Filled in by init, because /help lists the commands.
+var commandHandlers []*commandHandler
+
+func init() {
+	user := commandArg{Name: "@username"}
+	reason := commandArg{Name: "reason", Optional: true}
+	deleteArg := commandArg{Name: deleteFlag, Optional: true}
+
+	commandHandlers = []*commandHandler{
+		{Name: "/help", Aliases: []string{"/hello"}, Role: roleModerator, Handle: helpCommand,
+			Description: "Show the commands you can use."},
+		{Name: "/ban", Role: roleModerator, Handle: banCommand, Args: []commandArg{user, deleteArg, reason},
+			Description: "Kick and ban a user.", Details: "X-dX also deletes the replied-to message."},
+		{Name: "/tban", Role: roleModerator, Handle: tbanCommand, Args: []commandArg{user, {Name: "duration"}, reason},
+			Description: "Ban a user for a while.", Details: "For example for 30m, 12h, 7d or 1w."},
+		{Name: "/unban", Role: roleModerator, Handle: unbanCommand, Args: []commandArg{user, reason},
+			Description: "Unban a user."},
+		{Name: "/mute", Role: roleModerator, Handle: muteCommand, Args: []commandArg{user, {Name: "duration", Optional: true}, reason},
+			Description: "Mute a user.", Details: "For example for 30m, 12h, 7d or 1w. Forever if no duration is given."},
+		{Name: "/unmute", Role: roleModerator, Handle: unmuteCommand, Args: []commandArg{user, reason},
+			Description: "Unmute a user."},
+		{Name: "/warn", Role: roleModerator, Handle: warnCommand, Args: []commandArg{user, deleteArg, reason},
+			Description: "Warn a user.", Details: "X-dX also deletes the replied-to message."},
+		{Name: "/warns", Role: roleModerator, Handle: warnsCommand, Args: []commandArg{user},
+			Description: "List the warnings of a user."},
+		{Name: "/whois", Role: roleModerator, Handle: whoisCommand, Args: []commandArg{user},
+			Description: "Show the current and past usernames and names of a user."},
+		{Name: "/del", Role: roleModerator, Handle: delCommand,
+			Description: "Delete the replied-to message."},
+		{Name: "/purge", Role: roleModerator, Handle: purgeCommand,
+			Description: "Delete every message from the replied-to message up to the command."},
+		{Name: "/list", Role: roleModerator, Handle: listCommand,
+			Description: "List moderators."},
+		{Name: "/settings", Role: roleModerator, Handle: settingsCommand,
+			Description: "Show the settings of the supergroup."},
+		{Name: "/promote", Role: roleAdministrator, Handle: promoteCommand, Args: []commandArg{user},
+			Description: "Promote a user to moderator."},
+		{Name: "/demote", Role: roleAdministrator, Handle: demoteCommand, Args: []commandArg{user},
+			Description: "Demote a moderator to user."},
+		{Name: "/set", Role: roleAdministrator, Handle: setCommand, Args: []commandArg{{Name: "name"}, {Name: "value"}},
+			Description: "Change a setting of the supergroup."},
+	}
+}
+
+// Finds the command by its name or one of its aliases. Returns nil if there is no such command.
+func findCommand(Name string) *commandHandler {
+	for _, handler := range commandHandlers {
+		if handler.Name == Name {
+			return handler
+		}
+		for _, alias := range handler.Aliases {
+			if alias == Name {
+				return handler
+			}
+		}
+	}
+	return nil
+}
+
+// Usage of the command without formatting, for example: /tban @username duration [reason]
+func (c *commandHandler) usage() string {
+	parts := []string{c.Name}
+	for _, arg := range c.Args {
+		if arg.Optional {
+			parts = append(parts, "["+arg.Name+"]")
+		} else {
+			parts = append(parts, arg.Name)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Help line of the command. X will be replaced with backtick.
+func (c *commandHandler) help() string {
+	names := []string{"X" + c.Name + "X"}
+	for _, alias := range c.Aliases {
+		names = append(names, "X"+alias+"X")
+	}
+	line := strings.Join(names, ", ")
+	for _, arg := range c.Args {
+		if arg.Optional {
+			line += " _[" + arg.Name + "]_"
+		} else {
+			line += " _" + arg.Name + "_"
+		}
+	}
+	line += " - " + c.Description
+	if c.Details != "" {
+		line += " " + c.Details
+	}
+	return line
+}
+
+// Composes the help of the commands that the role can use.
+func commandsHelp(Role int) string {
+	text := ""
+	for _, handler := range commandHandlers {
+		if handler.Role <= Role {
+			text += "\n" + handler.help()
+		}
+	}
+	return strings.Replace(text, "X", "`", -1)
+}
+
+// Composes the Telegram command menu of the role: the commands that the role can use, without their aliases.
+// The descriptions are translated to the language, if there is a translation.
+func commandMenu(Role int, Language string) (menu []telegram.BotCommand) {
+	for _, handler := range commandHandlers {
+		if handler.Role > Role {
+			continue
+		}
+		description, ok := commandTranslations[Language][handler.Name]
+		if !ok {
+			description = handler.Description
+		}
+		menu = append(menu, telegram.BotCommand{Command: strings.TrimPrefix(handler.Name, "/"), Description: description})
+	}
+	return
+}
+
+// Command menu scopes and the role whose commands they show. Telegram does not tell moderators from the chat
+// administrators who can promote members, so every chat administrator sees the moderator commands only.
+// Administrators get their own menu in a supergroup with setAdministratorMenu.
+var commandMenuScopes = []struct {
+	Scope string
+	Role  int
+}{
+	{telegram.ScopeAllGroupChats, rolePublic},
+	{telegram.ScopeAllChatAdministrators, roleModerator},
+}
+
+// Languages of the command menus. The empty language is the English menu for everyone else.
+func commandMenuLanguages() []string {
+	languages := []string{""}
+	for language := range commandTranslations {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// SetCommandMenus registers the command menus of every scope and language with Telegram.
+// The menus of scopes without commands are removed.
+func SetCommandMenus(client *telegram.Client) error {
+	for _, menuScope := range commandMenuScopes {
+		scope := &telegram.BotCommandScope{Type: menuScope.Scope}
+		for _, language := range commandMenuLanguages() {
+			menu := commandMenu(menuScope.Role, language)
+			var err error
+			if len(menu) == 0 {
+				err = client.DeleteMyCommands(scope, language)
+			} else {
+				err = client.SetMyCommands(menu, scope, language)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteCommandMenus removes the command menus of every scope and language.
+func DeleteCommandMenus(client *telegram.Client) error {
+	for _, menuScope := range commandMenuScopes {
+		for _, language := range commandMenuLanguages() {
+			if err := client.DeleteMyCommands(&telegram.BotCommandScope{Type: menuScope.Scope}, language); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Registers the command menu of administrators for one administrator in one supergroup, in the language of the user.
+// The menu stays if the user is demoted later, but the commands check the privileges of the user anyway.
+func setAdministratorMenu(ctx *context.Context, ChatId int64, User *telegram.User) {
+	scope := &telegram.BotCommandScope{Type: telegram.ScopeChatMember, ChatId: ChatId, UserId: User.Id}
+	if err := ctx.Telegram.SetMyCommands(commandMenu(roleAdministrator, User.LanguageCode), scope, ""); err != nil {
+		log.Printf("[warning] setAdministratorMenu: %d, %d, %+v", ChatId, User.Id, err)
+	}
+}
+
+func helpCommand(ctx *context.Context, request *commandRequest) {
+	role := roleModerator
+	privilegeSnippet := " *moderator*"
+	if request.IsAdmin {
+		role = roleAdministrator
+		privilegeSnippet = "n *administrator*"
+		setAdministratorMenu(ctx, request.ChatId, request.Message.From)
+	}
+
+	text := fmt.Sprintf(textHelpMessage,
+		request.Message.From.FirstName,
+		privilegeSnippet,
+		commandsHelp(role))
+	ctx.Telegram.ReplyMessage(request.ChatId, request.MessageId, text)
+}
+
+func warnCommand(ctx *context.Context, request *commandRequest) {
+	chatId, messageId, message, command := request.ChatId, request.MessageId, request.Message, request.Command
+
+	deleteId, skipped := parseDeleteTarget(command, message)
+	warning := &db.Warning{
+		IssuerID:   message.From.Id,
+		IssuerName: message.From.String(),
+		Reason:     command.Reason,
+	}
+	if message.ReplyToMessage != nil {
+		warning.MessageID = message.ReplyToMessage.MessageId
+	}
+	users, invalid := CheckMembers(ctx, chatId, command, regular)
+	skipped = append(skipped, invalid...)
+	pending := &db.PendingAction{ChatID: chatId, MessageID: messageId, Command: request.Handler.Name, Reason: command.Reason, TargetMessageID: warning.MessageID, DeleteMessageID: deleteId}
+	if requestConfirmation(ctx, pending, message.From, users) {
+		replyErrors(ctx, chatId, messageId, skipped)
+		return
+	}
+	warned, errors := warnUsers(ctx, chatId, messageId, users, warning)
+	if warned {
+		errors = append(errors, deleteTargetMessage(ctx, chatId, deleteId)...)
+	}
+	replyErrors(ctx, chatId, messageId, append(skipped, errors...))
+}
+
+func warnsCommand(ctx *context.Context, request *commandRequest) {
+	chatId, messageId := request.ChatId, request.MessageId
+
+	users, skipped := CheckMembers(ctx, chatId, request.Command, everyone)
+	if len(users) < 1 {
+		ctx.Telegram.ReplyMessage(chatId, messageId, "No users found.")
+	}
+	replyErrors(ctx, chatId, messageId, skipped)
+	for _, user := range users {
+		list, actions, err := ListWarnings(ctx, chatId, user)
+		if err != nil {
+			ctx.Telegram.ReplyMessage(chatId, messageId, fmt.Sprintf("Could not get the warnings of [%s](tg://user?id=%d).", user.String(), user.Id))
+			continue
+		}
+		if len(list) < 1 && len(actions) < 1 {
+			ctx.Telegram.ReplyMessage(chatId, messageId, fmt.Sprintf("[%s](tg://user?id=%d) has no warnings.", user.String(), user.Id))
+			continue
+		}
+		var sections []string
+		if len(list) > 0 {
+			sections = append(sections, fmt.Sprintf(textListMessage, fmt.Sprintf("Warnings of [%s](tg://user?id=%d)", user.String(), user.Id), strings.Join(list, "\n")))
+		}
+		if len(actions) > 0 {
+			sections = append(sections, fmt.Sprintf(textListMessage, fmt.Sprintf("Bans and mutes of [%s](tg://user?id=%d)", user.String(), user.Id), strings.Join(actions, "\n")))
+		}
+		ctx.Telegram.ReplyMessage(chatId, messageId, strings.Join(sections, "\n\n"))
+	}
+}
+
+func whoisCommand(ctx *context.Context, request *commandRequest) {
+	chatId, messageId := request.ChatId, request.MessageId
+
+	users, skipped := CheckMembers(ctx, chatId, request.Command, everyone)
+	if len(users) < 1 {
+		ctx.Telegram.ReplyMessage(chatId, messageId, "No users found.")
+	}
+	replyErrors(ctx, chatId, messageId, skipped)
+	for _, user := range users {
+		list, err := ListUserHistory(ctx, user)
+		if err != nil {
+			ctx.Telegram.ReplyMessage(chatId, messageId, fmt.Sprintf("Could not get the history of [%s](tg://user?id=%d).", user.String(), user.Id))
+			continue
+		}
+		if len(list) < 1 {
+			ctx.Telegram.ReplyMessage(chatId, messageId, fmt.Sprintf("The bot has not seen [%s](tg://user?id=%d) yet.", user.String(), user.Id))
+			continue
+		}
+		ctx.Telegram.ReplyMessage(chatId, messageId, fmt.Sprintf(textListMessage, fmt.Sprintf("[%s](tg://user?id=%d), user ID %d", user.String(), user.Id, user.Id), strings.Join(list, "\n")))
+	}
+}
+
+func banCommand(ctx *context.Context, request *commandRequest) {
+	chatId, messageId, message, command := request.ChatId, request.MessageId, request.Message, request.Command
+
+	deleteId, skipped := parseDeleteTarget(command, message)
+	users, invalid := CheckMembers(ctx, chatId, command, regular)
+	skipped = append(skipped, invalid...)
+	pending := &db.PendingAction{ChatID: chatId, MessageID: messageId, Command: request.Handler.Name, Reason: command.Reason, DeleteMessageID: deleteId}
+	if requestConfirmation(ctx, pending, message.From, users) {
+		replyErrors(ctx, chatId, messageId, skipped)
+		return
+	}
+	banned, errors := banUsers(ctx, chatId, messageId, users, 0, command.Reason, request.Message.From)
+	if banned {
+		errors = append(errors, deleteTargetMessage(ctx, chatId, deleteId)...)
+	}
+	replyErrors(ctx, chatId, messageId, append(skipped, errors...))
+}
+
+func tbanCommand(ctx *context.Context, request *commandRequest) {
+	chatId, messageId, command := request.ChatId, request.MessageId, request.Command
+
+	until := parseDuration(command)
+	if until == 0 {
+		ctx.Telegram.ReplyMessage(chatId, messageId, fmt.Sprintf("Usage: `%s`, for example: `%s @username 3d spam`.", request.Handler.usage(), request.Handler.Name))
+		return
+	}
+	if durationError := checkRestrictDuration(until); durationError != nil {
+		ctx.Telegram.ReplyMessage(chatId, messageId, durationError.Error())
+		return
+	}
+	untilDate := time.Now().Add(until).Unix()
+	users, skipped := CheckMembers(ctx, chatId, command, regular)
+	pending := &db.PendingAction{ChatID: chatId, MessageID: messageId, Command: request.Handler.Name, UntilDate: untilDate, Reason: command.Reason}
+	if requestConfirmation(ctx, pending, request.Message.From, users) {
+		replyErrors(ctx, chatId, messageId, skipped)
+		return
+	}
+	_, errors := banUsers(ctx, chatId, messageId, users, untilDate, command.Reason, request.Message.From)
+	replyErrors(ctx, chatId, messageId, append(skipped, errors...))
+}
+
+func unbanCommand(ctx *context.Context, request *commandRequest) {
+	chatId, messageId, command := request.ChatId, request.MessageId, request.Command
+
+	users, skipped := CheckMembers(ctx, chatId, command, kicked)
+	list, errors := UnbanMember(ctx, chatId, users)
+	if len(list) < 1 {
+		ctx.Telegram.ReplyMessage(chatId, messageId, "No users were unbanned.")
+	} else {
+		ctx.Telegram.ReplyMessage(chatId, messageId, listMessage("Unbanned user(s)", list, command.Reason))
+	}
+	replyErrors(ctx, chatId, messageId, append(skipped, errors...))
+}
+
+func muteCommand(ctx *context.Context, request *commandRequest) {
+	chatId, messageId, command := request.ChatId, request.MessageId, request.Command
+
+	until := parseDuration(command)
+	if durationError := checkRestrictDuration(until); until > 0 && durationError != nil {
+		ctx.Telegram.ReplyMessage(chatId, messageId, durationError.Error())
+		return
+	}
+	var untilDate int64
+	if until > 0 {
+		untilDate = time.Now().Add(until).Unix()
+	}
+	users, skipped := CheckMembers(ctx, chatId, command, regular)
+	pending := &db.PendingAction{ChatID: chatId, MessageID: messageId, Command: request.Handler.Name, UntilDate: untilDate, Reason: command.Reason}
+	if requestConfirmation(ctx, pending, request.Message.From, users) {
+		replyErrors(ctx, chatId, messageId, skipped)
+		return
+	}
+	replyErrors(ctx, chatId, messageId, append(skipped, muteUsers(ctx, chatId, messageId, users, untilDate, command.Reason, request.Message.From)...))
+}
+
+func unmuteCommand(ctx *context.Context, request *commandRequest) {
+	chatId, messageId, command := request.ChatId, request.MessageId, request.Command
+
+	users, skipped := CheckMembers(ctx, chatId, command, restricted)
+	list, errors := ctx.Telegram.UnmuteMember(chatId, users)
+	if len(list) < 1 {
+		ctx.Telegram.ReplyMessage(chatId, messageId, "No users were unmuted.")
+	} else {
+		ctx.Telegram.ReplyMessage(chatId, messageId, listMessage("Unmuted user(s)", list, command.Reason))
+	}
+	replyErrors(ctx, chatId, messageId, append(skipped, errors...))
+}
+
+func delCommand(ctx *context.Context, request *commandRequest) {
+	chatId, messageId, message := request.ChatId, request.MessageId, request.Message
+
+	if message.ReplyToMessage == nil {
+		ctx.Telegram.ReplyMessage(chatId, messageId, fmt.Sprintf("Reply to the message to delete with `%s`.", request.Handler.Name))
+		return
+	}
+	if deleteError := ctx.Telegram.DeleteMessage(chatId, message.ReplyToMessage.MessageId); deleteError != nil {
+		ctx.Telegram.ReplyMessage(chatId, messageId, fmt.Sprintf("Could not delete the message: %s.", telegram.Explain(deleteError)))
+		return
+	}
+	ctx.Telegram.DeleteMessage(chatId, messageId)
+}
+
+func purgeCommand(ctx *context.Context, request *commandRequest) {
+	chatId, messageId, message := request.ChatId, request.MessageId, request.Message
+
+	if message.ReplyToMessage == nil {
+		ctx.Telegram.ReplyMessage(chatId, messageId, fmt.Sprintf("Reply to the first message to delete with `%s`.", request.Handler.Name))
+		return
+	}
+	first := message.ReplyToMessage.MessageId
+	if messageId-first >= defaults.PurgeLimit {
+		ctx.Telegram.ReplyMessage(chatId, messageId, fmt.Sprintf("At most %d messages can be purged at once.", defaults.PurgeLimit))
+		return
+	}
+	var ids []int64
+	for id := first; id <= messageId; id++ {
+		ids = append(ids, id)
+	}
+	if deleteError := ctx.Telegram.DeleteMessages(chatId, ids); deleteError != nil {
+		ctx.Telegram.ReplyMessage(chatId, messageId, fmt.Sprintf("Could not purge the messages: %s.", telegram.Explain(deleteError)))
+		return
+	}
+	log.Printf("[info] Purged messages %d to %d in %d by %+v.", first, messageId, chatId, message.From)
+	ctx.Telegram.ReplyMessage(chatId, 0, "Purge complete.")
+}
+
+func settingsCommand(ctx *context.Context, request *commandRequest) {
+	ctx.Telegram.ReplyMessage(request.ChatId, request.MessageId, chatSettingsText(ctx, GetChatSettings(ctx, request.ChatId)))
+}
+
+func listCommand(ctx *context.Context, request *commandRequest) {
+	list := ctx.Telegram.ListModerators(request.ChatId)
+	if len(list) < 1 {
+		ctx.Telegram.ReplyMessage(request.ChatId, request.MessageId, "No moderators found.")
+	} else {
+		ctx.Telegram.ReplyMessage(request.ChatId, request.MessageId, fmt.Sprintf(textListMessage, "Moderators", strings.Join(list, textNewlineComma)))
+	}
+}
+
+func promoteCommand(ctx *context.Context, request *commandRequest) {
+	chatId, messageId, command := request.ChatId, request.MessageId, request.Command
+
+	users, skipped := CheckMembers(ctx, chatId, command, regular)
+	list, errors := ctx.Telegram.AddModerator(chatId, users)
+	if len(list) < 1 {
+		ctx.Telegram.ReplyMessage(chatId, messageId, "No moderators were added.")
+	} else {
+		ctx.Telegram.ReplyMessage(chatId, messageId, listMessage("Added moderator(s)", list, command.Reason))
+	}
+	replyErrors(ctx, chatId, messageId, append(skipped, errors...))
+}
+
+func demoteCommand(ctx *context.Context, request *commandRequest) {
+	chatId, messageId, command := request.ChatId, request.MessageId, request.Command
+
+	users, skipped := CheckMembers(ctx, chatId, command, moderators)
+	list, errors := ctx.Telegram.RemoveModerator(chatId, users)
+	if len(list) < 1 {
+		ctx.Telegram.ReplyMessage(chatId, messageId, "No moderators were removed.")
+	} else {
+		ctx.Telegram.ReplyMessage(chatId, messageId, listMessage("Removed moderator(s)", list, command.Reason))
+	}
+	replyErrors(ctx, chatId, messageId, append(skipped, errors...))
+}
+
+func setCommand(ctx *context.Context, request *commandRequest) {
+	chatId, messageId := request.ChatId, request.MessageId
+
+	settings, getSettingsError := ctx.DB.GetChatSettings(chatId)
+	if getSettingsError != nil {
+		log.Printf("[error] GetChatSettings: %d, %+v", chatId, getSettingsError)
+		ctx.Telegram.ReplyMessage(chatId, messageId, "Could not read the settings.")
+		return
+	}
+	if setError := setChatSetting(settings, strings.Fields(request.Command.Reason)); setError != nil {
+		ctx.Telegram.ReplyMessage(chatId, messageId, setError.Error())
+		return
+	}
+	if updateSettingsError := ctx.DB.UpdateChatSettings(settings); updateSettingsError != nil {
+		log.Printf("[error] UpdateChatSettings: %d, %+v", chatId, updateSettingsError)
+		ctx.Telegram.ReplyMessage(chatId, messageId, "Could not save the settings.")
+		return
+	}
+	ctx.Telegram.ReplyMessage(chatId, messageId, chatSettingsText(ctx, settings))
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+// A translation of a renamed or removed command would silently never show up in the menu.
+func TestCommandTranslations(t *testing.T) {
+	for language, translations := range commandTranslations {
+		for name := range translations {
+			if handler := findCommand(name); handler == nil || handler.Name != name {
+				t.Errorf("translation of unknown command %s in language %s", name, language)
+			}
+		}
+	}
+}
+
+func TestAdministratorMenu(t *testing.T) {
+	menu := map[string]bool{}
+	for _, command := range commandMenu(roleAdministrator, "de") {
+		menu[command.Command] = true
+	}
+	for _, name := range []string{"promote", "demote", "set", "ban"} {
+		if !menu[name] {
+			t.Errorf("administrator menu has no %s command", name)
+		}
+	}
+}
@@ -4,14 +4,21 @@ package config
 import (
 	"github.com/go-ini/ini"
 	"os"
+	"strconv"
 )
 
 // Config holds a complete set of dynamic configuration.
 type Config struct {
 	Environment string `json:"ENVIRONMENT"`
 	AWSRegion   string `json:"AWSREGION"`
-	//	Timeout       int64  `json:"TIMEOUT"`
+	// Seconds the bot has to answer an update in webhook mode. Zero means the default.
+	Timeout       int64  `json:"TIMEOUT"`
 	TelegramToken string `json:"TELEGRAMTOKEN"`
+	TelegramAPI   string `json:"TELEGRAMAPI"`
+	WebhookSecret string `json:"WEBHOOKSECRET"`
+	Database      string `json:"DATABASE"`
+	DatabasePath  string `json:"DATABASEPATH"`
+	Escalation    string `json:"ESCALATION"`
 }
 
 // GetConfigFromFile reads the configuration from an INI-style file and returns a Config struct.
@@ -26,12 +33,18 @@ func GetConfigFromFile(configFile string) (*Config, error) {
 		Environment:   inicfg.Section("").Key("ENVIRONMENT").String(),
 		AWSRegion:     inicfg.Section("").Key("AWSREGION").String(),
 		TelegramToken: inicfg.Section("").Key("TELEGRAMTOKEN").String(),
+		TelegramAPI:   inicfg.Section("").Key("TELEGRAMAPI").String(),
+		WebhookSecret: inicfg.Section("").Key("WEBHOOKSECRET").String(),
+		Database:      inicfg.Section("").Key("DATABASE").String(),
+		DatabasePath:  inicfg.Section("").Key("DATABASEPATH").String(),
+		Escalation:    inicfg.Section("").Key("ESCALATION").String(),
 	}
-	/*	cfg.Timeout, err = inicfg.Section("").Key("TIMEOUT").Int64()
+	if timeout := inicfg.Section("").Key("TIMEOUT").String(); timeout != "" {
+		cfg.Timeout, err = strconv.ParseInt(timeout, 10, 64)
 		if err != nil {
 			return nil, err
 		}
-	*/
+	}
 	return &cfg, nil
 }
 
@@ -41,16 +54,19 @@ func GetConfigFromENV() (*Config, error) {
 		Environment:   os.Getenv("ENVIRONMENT"),
 		AWSRegion:     os.Getenv("AWSREGION"),
 		TelegramToken: os.Getenv("TELEGRAMTOKEN"),
+		TelegramAPI:   os.Getenv("TELEGRAMAPI"),
+		WebhookSecret: os.Getenv("WEBHOOKSECRET"),
+		Database:      os.Getenv("DATABASE"),
+		DatabasePath:  os.Getenv("DATABASEPATH"),
+		Escalation:    os.Getenv("ESCALATION"),
 	}
 
-	/*	timeoutString := os.Getenv("TIMEOUT")
-		if timeoutString == "" {
-			timeoutString = "90"
-		}
+	if timeoutString := os.Getenv("TIMEOUT"); timeoutString != "" {
 		timeout, err := strconv.ParseInt(timeoutString, 10, 64)
 		if err != nil {
 			return nil, err
 		}
 		config.Timeout = timeout
-	*/return &config, nil
+	}
+	return &config, nil
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/freshautomations/telegram-moderator-bot/context"
+	"github.com/freshautomations/telegram-moderator-bot/db"
+	"github.com/freshautomations/telegram-moderator-bot/defaults"
+	"github.com/freshautomations/telegram-moderator-bot/duration"
+	"github.com/freshautomations/telegram-moderator-bot/telegram"
+	"log"
+	"time"
+)
+
+// Asks the issuer of a moderation command to confirm it, if the settings of the supergroup require it.
+// Action holds the chat, the message and the arguments of the command, the issuer, the users and the expiry are set here.
+// Returns true if the command waits for the confirmation (or could not be set up) and must not be run now.
+func requestConfirmation(ctx *context.Context, Action *db.PendingAction, Issuer *telegram.User, Users []*telegram.User) bool {
+	ChatId, MessageId := Action.ChatID, Action.MessageID
+	if !needsConfirmation(ctx, GetChatSettings(ctx, ChatId), Users) {
+		return false
+	}
+
+	action := *Action
+	action.IssuerID = Issuer.Id
+	action.Users = nil
+	action.Expires = time.Now().Add(defaults.ConfirmationTimeout).Unix()
+	var targets []string
+	for _, user := range Users {
+		action.Users = append(action.Users, user.Id)
+		targets = append(targets, fmt.Sprintf("[%s](tg://user?id=%d)", user.String(), user.Id))
+	}
+
+	keyboard, err := confirmationKeyboard(ctx, &action)
+	if err == nil {
+		err = ctx.DB.AddPendingAction(&action)
+	}
+	if err != nil {
+		log.Printf("[error] requestConfirmation: %d, %+v", ChatId, err)
+		ctx.Telegram.ReplyMessage(ChatId, MessageId, "Could not ask for a confirmation, the command was not run.")
+		return true
+	}
+
+	title := fmt.Sprintf("[%s](tg://user?id=%d), confirm %s against these user(s) within %s", Issuer.String(), Issuer.Id, action.Command, duration.Format(defaults.ConfirmationTimeout))
+	ctx.Telegram.ReplyMessageWithKeyboard(ChatId, MessageId, listMessage(title, targets, action.Reason), keyboard)
+	return true
+}
+
+// Checks if a command against the users has to be confirmed: there are more users than the setting allows
+// or one of them was first seen by the bot longer ago than the setting. Telegram does not tell when a user joined
+// the chat, so the first time the bot saw the user in any chat stands in for the membership age.
+func needsConfirmation(ctx *context.Context, Settings *db.ChatSettings, Users []*telegram.User) bool {
+	if Settings.ConfirmUsers > 0 && len(Users) > Settings.ConfirmUsers {
+		return true
+	}
+	if Settings.ConfirmAge == 0 {
+		return false
+	}
+
+	seenBefore := time.Now().Unix() - Settings.ConfirmAge
+	for _, user := range Users {
+		history, err := ctx.DB.GetUserHistory(user.Id)
+		if err != nil {
+			// Better ask once too often than ban an old member by mistake.
+			log.Printf("[error] needsConfirmation GetUserHistory: %+v, %+v", user, err)
+			return true
+		}
+		if history != nil && history.FirstSeen < seenBefore {
+			return true
+		}
+	}
+	return false
+}
+
+// Creates the Confirm and Cancel buttons of a pending action and sets its ID.
+func confirmationKeyboard(ctx *context.Context, action *db.PendingAction) (*telegram.InlineKeyboardMarkup, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	action.ID = base64.RawURLEncoding.EncodeToString(id)
+
+	confirm, err := callbackButton(ctx, action.ChatID, "Confirm", actionConfirm, action.ID)
+	if err != nil {
+		return nil, err
+	}
+	cancel, err := callbackButton(ctx, action.ChatID, "Cancel", actionCancel, action.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{{confirm, cancel}}}, nil
+}
+
+// Runs the pending action of the button.
+func confirmCallback(ctx *context.Context, query *telegram.CallbackQuery, args []string) string {
+	action, answer := takePendingAction(ctx, query, args[0])
+	if action == nil {
+		return answer
+	}
+
+	log.Printf("[info] %s in %d confirmed by %+v.", action.Command, action.ChatID, query.From)
+	closePrompt(ctx, query, fmt.Sprintf("Confirmed by %s.", query.From.String()))
+	runPendingAction(ctx, action, query.From)
+	return "Confirmed."
+}
+
+// Drops the pending action of the button.
+func cancelCallback(ctx *context.Context, query *telegram.CallbackQuery, args []string) string {
+	action, answer := takePendingAction(ctx, query, args[0])
+	if action == nil {
+		return answer
+	}
+
+	closePrompt(ctx, query, fmt.Sprintf("Cancelled by %s.", query.From.String()))
+	return "Cancelled."
+}
+
+// Removes the pending action of a button from the database, so it is answered only once.
+// Returns nil and the answer for the user who clicked if the action is not there, has expired,
+// the user is not the issuer of the command or another click took the action first.
+func takePendingAction(ctx *context.Context, query *telegram.CallbackQuery, Id string) (*db.PendingAction, string) {
+	chatId := query.Message.Chat.Id
+	action, err := ctx.DB.GetPendingAction(chatId, Id)
+	if err != nil {
+		log.Printf("[error] GetPendingAction: %d, %s, %+v", chatId, Id, err)
+		return nil, "Could not read the command."
+	}
+
+	now := time.Now().Unix()
+	// A prompt whose action is gone before its time was answered by another click, which closed the prompt already.
+	if action == nil && int64(query.Message.Date)+int64(defaults.ConfirmationTimeout/time.Second) >= now {
+		return nil, "The command was answered already."
+	}
+	if action == nil || action.Expires < now {
+		if action != nil {
+			_, _ = ctx.DB.TakePendingAction(chatId, Id)
+		}
+		closePrompt(ctx, query, "The confirmation has expired.")
+		return nil, "The confirmation has expired."
+	}
+
+	if action.IssuerID != query.From.Id {
+		return nil, "Only the moderator who issued the command can answer."
+	}
+
+	// Only the click that removed the action runs it, a second click at the same time finds nothing.
+	action, err = ctx.DB.TakePendingAction(chatId, Id)
+	if err != nil {
+		log.Printf("[error] TakePendingAction: %d, %s, %+v", chatId, Id, err)
+		return nil, "Could not update the command."
+	}
+	if action == nil {
+		return nil, "The command was answered already."
+	}
+	return action, ""
+}
+
+// Runs a confirmed command on behalf of its issuer. The users are checked again, they might have changed since the command was issued.
+func runPendingAction(ctx *context.Context, action *db.PendingAction, Issuer *telegram.User) {
+	command := &CommandData{Command: action.Command, UserIds: action.Users, Reason: action.Reason}
+	users, skipped := CheckMembers(ctx, action.ChatID, command, regular)
+
+	var done bool
+	var errors []string
+	switch action.Command {
+	case "/ban", "/tban":
+		done, errors = banUsers(ctx, action.ChatID, action.MessageID, users, action.UntilDate, action.Reason, Issuer)
+	case "/mute":
+		errors = muteUsers(ctx, action.ChatID, action.MessageID, users, action.UntilDate, action.Reason, Issuer)
+	case "/warn":
+		warning := &db.Warning{
+			IssuerID:   Issuer.Id,
+			IssuerName: Issuer.String(),
+			Reason:     action.Reason,
+			MessageID:  action.TargetMessageID,
+		}
+		done, errors = warnUsers(ctx, action.ChatID, action.MessageID, users, warning)
+	default:
+		log.Printf("[error] runPendingAction: unknown command %s", action.Command)
+		return
+	}
+	if done {
+		errors = append(errors, deleteTargetMessage(ctx, action.ChatID, action.DeleteMessageID)...)
+	}
+	replyErrors(ctx, action.ChatID, action.MessageID, append(skipped, errors...))
+}
+
+// Removes the buttons of a confirmation prompt and adds a note to its text, so an answered or expired prompt
+// can not be clicked anymore. The empty keyboard replaces the buttons explicitly.
+func closePrompt(ctx *context.Context, query *telegram.CallbackQuery, Note string) {
+	noButtons := &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{}}
+	ctx.Telegram.EditMessageText(query.Message.Chat.Id, query.Message.MessageId, fmt.Sprintf("%s\n%s", query.Message.Text, Note), noButtons)
+}
@@ -3,26 +3,27 @@ package context
 
 import (
 	"encoding/json"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/freshautomations/telegram-moderator-bot/config"
+	"github.com/freshautomations/telegram-moderator-bot/db"
 	"github.com/freshautomations/telegram-moderator-bot/defaults"
+	"github.com/freshautomations/telegram-moderator-bot/telegram"
 	"log"
 	"net/http"
 )
 
 // Context holds current execution details.
 type Context struct {
-	AWSSession *session.Session
-
-	DDBSession *dynamodb.DynamoDB
-
-	DBUserTable string
-
-	DBWarnTable string
+	// Storage backend
+	DB db.Store
 
 	// Application configuration
 	Cfg *config.Config
+
+	// Telegram Bot API client
+	Telegram *telegram.Client
+
+	// Username of the bot, learned through getMe. Empty if it could not be read.
+	BotUsername string
 }
 
 // InitialContext holds the input parameter details at the start of execution.
@@ -38,6 +39,12 @@ type InitialContext struct {
 
 	// --webserver was set
 	LocalExecution bool
+
+	// --poll was set
+	Poll bool
+
+	// --migrate-warns Chat ID that receives the chat-independent warnings of earlier versions
+	MigrateWarnsChatId int64
 }
 
 // New creates a fresh Context.
@@ -0,0 +1,392 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"strconv"
+	"time"
+)
+
+// Bolt bucket names.
+var (
+	boltUserBucket       = []byte("users")
+	boltHistoryBucket    = []byte("userids")
+	boltWarnBucket       = []byte("chatwarns")
+	boltLegacyWarnBucket = []byte("warns")
+	boltChatBucket       = []byte("chats")
+	boltPendingBucket    = []byte("pending")
+	boltUpdateBucket     = []byte("updates")
+)
+
+// boltUser is the record stored in the users bucket.
+type boltUser struct {
+	UserData
+	LastSeen int64 `json:"lastseen"`
+}
+
+// BoltStore keeps the data in a local BoltDB file. Useful for self-hosted deployments.
+type BoltStore struct {
+	DB *bolt.DB
+}
+
+// NewBoltStore opens (or creates) the BoltDB file at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	if path == "" {
+		path = "tmb.db"
+	}
+	boltDB, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = boltDB.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltUserBucket, boltHistoryBucket, boltWarnBucket, boltLegacyWarnBucket, boltChatBucket, boltPendingBucket, boltUpdateBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		boltDB.Close()
+		return nil, err
+	}
+	return &BoltStore{DB: boltDB}, nil
+}
+
+func (s *BoltStore) UpdateUserData(User *UserData) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		users, histories := tx.Bucket(boltUserBucket), tx.Bucket(boltHistoryBucket)
+		now := time.Now().Unix()
+
+		history := &UserHistory{}
+		historyKey := []byte(strconv.Itoa(User.UserID))
+		if value := histories.Get(historyKey); value != nil {
+			if err := json.Unmarshal(value, history); err != nil {
+				return err
+			}
+		}
+		previousUsername, changed := history.update(User, now)
+
+		if User.Username != "" {
+			// Records written before the history existed know when the user was first seen.
+			for _, key := range usernameKeys(User.Username) {
+				previous := boltUser{}
+				if value := users.Get([]byte(key)); value != nil && json.Unmarshal(value, &previous) == nil &&
+					previous.UserID == User.UserID && previous.FirstSeen != 0 && previous.FirstSeen < history.FirstSeen {
+					history.FirstSeen = previous.FirstSeen
+					changed = true
+				}
+			}
+		}
+
+		if changed {
+			value, err := json.Marshal(history)
+			if err != nil {
+				return err
+			}
+			if err = histories.Put(historyKey, value); err != nil {
+				return err
+			}
+		}
+
+		if previousUsername != "" {
+			for _, key := range usernameKeys(previousUsername) {
+				previous := boltUser{}
+				if value := users.Get([]byte(key)); value != nil && json.Unmarshal(value, &previous) == nil && previous.UserID == User.UserID {
+					if err := users.Delete([]byte(key)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if User.Username == "" || !changed {
+			return nil
+		}
+		record := boltUser{*User, history.LastSeen}
+		record.FirstSeen = history.FirstSeen
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return users.Put([]byte(NormalizeUsername(User.Username)), value)
+	})
+}
+
+func (s *BoltStore) GetUserData(username string) (output *UserData, err error) {
+	err = s.DB.View(func(tx *bolt.Tx) error {
+		for _, key := range usernameKeys(username) {
+			value := tx.Bucket(boltUserBucket).Get([]byte(key))
+			if value == nil {
+				continue
+			}
+			record := boltUser{}
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			output = &record.UserData
+			return nil
+		}
+		return nil
+	})
+	return
+}
+
+func (s *BoltStore) GetUserHistory(userId int) (output *UserHistory, err error) {
+	err = s.DB.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltHistoryBucket).Get([]byte(strconv.Itoa(userId)))
+		if value == nil {
+			return nil
+		}
+		output = &UserHistory{}
+		return json.Unmarshal(value, output)
+	})
+	return
+}
+
+func (s *BoltStore) AddWarning(warning *Warning) (output *WarnData, err error) {
+	err = s.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltWarnBucket)
+		key := boltWarnKey(warning.ChatID, warning.UserID)
+		record, err := getBoltWarns(bucket, key)
+		if err != nil {
+			return err
+		}
+		record.Warn++
+		record.Warnings = append(record.Warnings, warning)
+		output = record
+		return putBoltWarns(bucket, key, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s *BoltStore) GetWarnData(chatId int64, userId int) (output *WarnData, err error) {
+	err = s.DB.View(func(tx *bolt.Tx) (err error) {
+		output, err = getBoltWarns(tx.Bucket(boltWarnBucket), boltWarnKey(chatId, userId))
+		return
+	})
+	return
+}
+
+func (s *BoltStore) AddModerationAction(action *ModerationAction) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltWarnBucket)
+		key := boltWarnKey(action.ChatID, action.UserID)
+		record, err := getBoltWarns(bucket, key)
+		if err != nil {
+			return err
+		}
+		record.Actions = append(record.Actions, action)
+		return putBoltWarns(bucket, key, record)
+	})
+}
+
+func (s *BoltStore) ResetUserWarn(chatId int64, userId int) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltWarnBucket)
+		key := boltWarnKey(chatId, userId)
+		record, err := getBoltWarns(bucket, key)
+		if err != nil {
+			return err
+		}
+		record.Warn = 0
+		record.Reset = time.Now().Unix()
+		record.ResetIndex = len(record.Warnings)
+		return putBoltWarns(bucket, key, record)
+	})
+}
+
+// MigrateLegacyWarns adds the counters of the legacy warns bucket to the chat and empties the legacy bucket.
+func (s *BoltStore) MigrateLegacyWarns(chatId int64) (migrated []LegacyWarn, err error) {
+	err = s.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltWarnBucket)
+		err := tx.Bucket(boltLegacyWarnBucket).ForEach(func(key, value []byte) error {
+			userId, err := strconv.Atoi(string(key))
+			if err != nil {
+				return err
+			}
+			warn, err := strconv.Atoi(string(value))
+			if err != nil {
+				return err
+			}
+			if warn < 1 {
+				return nil
+			}
+			record, err := getBoltWarns(bucket, boltWarnKey(chatId, userId))
+			if err != nil {
+				return err
+			}
+			record.Warn += warn
+			if err = putBoltWarns(bucket, boltWarnKey(chatId, userId), record); err != nil {
+				return err
+			}
+			migrated = append(migrated, LegacyWarn{UserID: userId, Warn: warn})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err = tx.DeleteBucket(boltLegacyWarnBucket); err != nil {
+			return err
+		}
+		_, err = tx.CreateBucket(boltLegacyWarnBucket)
+		return err
+	})
+	if err != nil {
+		// The transaction was rolled back, nothing was moved.
+		migrated = nil
+	}
+	return
+}
+
+func (s *BoltStore) GetChatSettings(chatId int64) (output *ChatSettings, err error) {
+	output = &ChatSettings{}
+	err = s.DB.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltChatBucket).Get([]byte(strconv.FormatInt(chatId, 10)))
+		if value == nil {
+			return nil
+		}
+		return json.Unmarshal(value, output)
+	})
+	output.ChatID = chatId
+	return
+}
+
+func (s *BoltStore) UpdateChatSettings(settings *ChatSettings) error {
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltChatBucket).Put([]byte(strconv.FormatInt(settings.ChatID, 10)), value)
+	})
+}
+
+func (s *BoltStore) AddPendingAction(action *PendingAction) error {
+	value, err := json.Marshal(action)
+	if err != nil {
+		return err
+	}
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltPendingBucket)
+		now := time.Now().Unix()
+		var expired [][]byte
+		cursor := bucket.Cursor()
+		for key, stored := cursor.First(); key != nil; key, stored = cursor.Next() {
+			pending := PendingAction{}
+			if json.Unmarshal(stored, &pending) != nil || pending.Expires < now {
+				expired = append(expired, key)
+			}
+		}
+		for _, key := range expired {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return bucket.Put(boltPendingKey(action.ChatID, action.ID), value)
+	})
+}
+
+func (s *BoltStore) GetPendingAction(chatId int64, id string) (output *PendingAction, err error) {
+	err = s.DB.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltPendingBucket).Get(boltPendingKey(chatId, id))
+		if value == nil {
+			return nil
+		}
+		output = &PendingAction{}
+		return json.Unmarshal(value, output)
+	})
+	return
+}
+
+func (s *BoltStore) TakePendingAction(chatId int64, id string) (output *PendingAction, err error) {
+	err = s.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltPendingBucket)
+		key := boltPendingKey(chatId, id)
+		value := bucket.Get(key)
+		if value == nil {
+			return nil
+		}
+		output = &PendingAction{}
+		if err := json.Unmarshal(value, output); err != nil {
+			return err
+		}
+		return bucket.Delete(key)
+	})
+	if err != nil {
+		output = nil
+	}
+	return
+}
+
+// AddUpdate records the update ID. Update IDs grow, so the expired ones are at the start of the bucket.
+func (s *BoltStore) AddUpdate(updateId int, expires int64) (added bool, err error) {
+	err = s.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltUpdateBucket)
+		now := time.Now().Unix()
+		var expired [][]byte
+		cursor := bucket.Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			if until, err := strconv.ParseInt(string(value), 10, 64); err == nil && until >= now {
+				break
+			}
+			expired = append(expired, key)
+		}
+		for _, key := range expired {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		key := boltUpdateKey(updateId)
+		if bucket.Get(key) != nil {
+			return nil
+		}
+		added = true
+		return bucket.Put(key, []byte(strconv.FormatInt(expires, 10)))
+	})
+	return
+}
+
+// boltUpdateKey is the key of an update ID in the updates bucket. It is zero-padded, so the keys sort by ID.
+func boltUpdateKey(updateId int) []byte {
+	return []byte(fmt.Sprintf("%020d", updateId))
+}
+
+// boltPendingKey is the key of a pending action in the pending bucket.
+func boltPendingKey(chatId int64, id string) []byte {
+	return []byte(strconv.FormatInt(chatId, 10) + ":" + id)
+}
+
+// boltWarnKey is the key of a user's warning record in the warns bucket.
+func boltWarnKey(chatId int64, userId int) []byte {
+	return []byte(strconv.FormatInt(chatId, 10) + ":" + strconv.Itoa(userId))
+}
+
+// getBoltWarns reads the warning record stored under key. Records written before the warning history
+// was introduced only hold the counter.
+func getBoltWarns(bucket *bolt.Bucket, key []byte) (*WarnData, error) {
+	record := &WarnData{}
+	value := bucket.Get(key)
+	if value == nil {
+		return record, nil
+	}
+	if warn, err := strconv.Atoi(string(value)); err == nil {
+		record.Warn = warn
+		return record, nil
+	}
+	return record, json.Unmarshal(value, record)
+}
+
+// putBoltWarns stores the warning record under key.
+func putBoltWarns(bucket *bolt.Bucket, key []byte, record *WarnData) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, value)
+}
@@ -1,149 +1,189 @@
+// Db package declares the storage interface of the bot and its backends.
 package db
 
 import (
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"github.com/freshautomations/telegram-moderator-bot/context"
-	"os"
-	"strconv"
-	"time"
+	"fmt"
+	"github.com/freshautomations/telegram-moderator-bot/config"
 )
 
+// Available storage backends. Select one with the DATABASE configuration key.
+const (
+	BackendDynamoDB = "dynamodb"
+	BackendBolt     = "bolt"
+	BackendMemory   = "memory"
+)
+
+// UserData holds the details of a user that the bot has seen.
 type UserData struct {
 	Username string `json:"username"`
 	UserID   int    `json:"id"`
 	Name     string `json:"name"`
+
+	// Time the bot first saw the user. Zero if it is not known.
+	FirstSeen int64 `json:"firstseen,omitempty"`
 }
 
-func Initialize(ctx *context.Context) {
-	awscfg := aws.Config{
-		Region: aws.String(ctx.Cfg.AWSRegion),
-	}
+// Warning is a warning issued by a moderator to a user in a chat.
+type Warning struct {
+	ChatID     int64  `json:"chat"`
+	UserID     int    `json:"id"`
+	IssuerID   int    `json:"issuer"`
+	IssuerName string `json:"issuername,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	MessageID  int64  `json:"message,omitempty"`
+	Date       int64  `json:"date"`
+}
 
-	// Use IAM or environment variables credential
-	if (os.Getenv("AWS_ACCESS_KEY_ID") != "" && os.Getenv("AWS_SECRET_ACCESS_KEY") != "") ||
-		(os.Getenv("AWS_ACCESS_KEY") != "" && os.Getenv("AWS_SECRET_KEY") != "") {
-		awscfg.Credentials = credentials.NewEnvCredentials()
-	}
-	ctx.AWSSession = session.Must(session.NewSessionWithOptions(session.Options{Config: awscfg}))
-	ctx.DDBSession = dynamodb.New(ctx.AWSSession)
-	ctx.DBUserTable = "tmb-" + ctx.Cfg.Environment + "-users"
-	ctx.DBWarnTable = "tmb-" + ctx.Cfg.Environment + "-warns"
+// LegacyWarn is a warning counter of a user in the old, chat-independent storage.
+type LegacyWarn struct {
+	UserID int `json:"id"`
+	Warn   int `json:"warn"`
 }
 
-func UpdateUserData(ctx *context.Context, User *UserData) (err error) {
-	_, err = ctx.DDBSession.UpdateItem(&dynamodb.UpdateItemInput{
-		//		ConditionExpression:         aws.String("attribute_not_exists #userid OR attribute_not_exists #name OR (attribute_exists #userid AND #userid <> :userid) OR (attribute_exists #name AND #name <> :name)"),
-		ExpressionAttributeNames: map[string]*string{
-			"#userid":   aws.String("id"),
-			"#name":     aws.String("name"),
-			"#lastseen": aws.String("lastseen"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":userid": {
-				N: aws.String(strconv.Itoa(User.UserID)),
-			},
-			":name": {
-				S: aws.String(User.Name),
-			},
-			":lastseen": {
-				N: aws.String(strconv.FormatInt(time.Now().Unix(), 10)),
-			},
-		},
-		Key: map[string]*dynamodb.AttributeValue{
-			"username": {
-				S: aws.String(User.Username),
-			},
-		},
-		TableName:        aws.String(ctx.DBUserTable),
-		UpdateExpression: aws.String("SET #userid = :userid, #name = :name, #lastseen = :lastseen"),
-	})
-	return
+// Moderation actions that are recorded with their reason.
+const (
+	ActionBan  = "ban"
+	ActionMute = "mute"
+)
+
+// ModerationAction is a ban or mute of a user in a chat, kept so its reason can be looked up later.
+type ModerationAction struct {
+	ChatID     int64  `json:"chat"`
+	UserID     int    `json:"id"`
+	Action     string `json:"action"`
+	IssuerID   int    `json:"issuer"`
+	IssuerName string `json:"issuername,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Date       int64  `json:"date"`
+
+	// Time the action ends. Zero if it is permanent.
+	UntilDate int64 `json:"until,omitempty"`
 }
 
-func GetUserData(ctx *context.Context, username string) (*UserData, error) {
-	result, err := ctx.DDBSession.GetItem(&dynamodb.GetItemInput{
-		//		ConsistentRead: aws.Bool(true),
-		Key: map[string]*dynamodb.AttributeValue{
-			"username": {
-				S: aws.String(username),
-			},
-		},
-		ExpressionAttributeNames: map[string]*string{
-			"#username": aws.String("username"),
-			"#userid":   aws.String("id"),
-			"#name":     aws.String("name"),
-		},
-		ProjectionExpression: aws.String("#username, #userid, #name"),
-		TableName:            aws.String(ctx.DBUserTable),
-	})
-	if err != nil {
-		return nil, err
-	}
+// WarnData is the stored state of a user's warnings in a chat.
+type WarnData struct {
+	// Number of warnings since the last reset, including the ones issued before the warning history existed.
+	Warn int `json:"warn"`
 
-	output := UserData{}
+	// Time of the last reset. Warnings issued before it do not count.
+	Reset int64 `json:"reset,omitempty"`
 
-	err = dynamodbattribute.UnmarshalMap(result.Item, &output)
+	// Number of warnings in the history at the last reset. Those do not count, even if they were issued in the
+	// same second as the reset. Zero for resets recorded before the field existed, only Reset applies to them.
+	ResetIndex int `json:"resetindex,omitempty"`
 
-	if output.UserID == 0 || err != nil {
-		return nil, err
-	}
+	// Warning history, oldest first.
+	Warnings []*Warning `json:"warnings"`
 
-	return &output, err
+	// Bans and mutes of the user in the chat, oldest first.
+	Actions []*ModerationAction `json:"actions,omitempty"`
 }
 
-func AddWarnToUser(ctx *context.Context, userId int) (int, error) {
-	result, err := ctx.DDBSession.UpdateItem(&dynamodb.UpdateItemInput{
-		ExpressionAttributeNames: map[string]*string{
-			"#warn": aws.String("warn"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":warn": {
-				N: aws.String("1"),
-			},
-		},
-		Key: map[string]*dynamodb.AttributeValue{
-			"id": {
-				N: aws.String(strconv.Itoa(userId)),
-			},
-		},
-		TableName:        aws.String(ctx.DBWarnTable),
-		UpdateExpression: aws.String("ADD #warn :warn"),
-		ReturnValues:     aws.String("UPDATED_NEW"),
-	})
-	if err != nil {
-		return -1, err
-	}
+// ChatSettings holds the per-chat configuration that administrators can change.
+type ChatSettings struct {
+	ChatID int64 `json:"chat"`
+
+	// Seconds after which a warning stops counting. Zero means never.
+	WarnExpiry int64 `json:"warnexpiry,omitempty"`
+
+	// Seconds after which one warning, the oldest one, stops counting. Zero means never.
+	WarnDecay int64 `json:"warndecay,omitempty"`
+
+	// Escalation policy for warnings. Empty means the configured default.
+	Escalation string `json:"escalation,omitempty"`
 
-	output := struct {
-		Warn int `json:"warn"`
-	}{-1}
+	// Number of users above which moderation commands have to be confirmed. Zero means never.
+	ConfirmUsers int `json:"confirmusers,omitempty"`
 
-	err = dynamodbattribute.UnmarshalMap(result.Attributes, &output)
-	return output.Warn, err
+	// Seconds since the bot first saw a user, in any chat, above which moderation commands against the user have to
+	// be confirmed. It stands in for the membership age, which Telegram does not tell. Zero means never.
+	ConfirmAge int64 `json:"confirmage,omitempty"`
 }
 
-func ResetUserWarn(ctx *context.Context, userId int) error {
-	_, err := ctx.DDBSession.UpdateItem(&dynamodb.UpdateItemInput{
-		ExpressionAttributeNames: map[string]*string{
-			"#warn": aws.String("warn"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":warn": {
-				N: aws.String("0"),
-			},
-		},
-		Key: map[string]*dynamodb.AttributeValue{
-			"id": {
-				N: aws.String(strconv.Itoa(userId)),
-			},
-		},
-		TableName:        aws.String(ctx.DBWarnTable),
-		UpdateExpression: aws.String("SET #warn = :warn"),
-		ReturnValues:     aws.String("UPDATED_NEW"),
-	})
-	return err
+// PendingAction is a moderation command that waits for the confirmation of the moderator who issued it.
+type PendingAction struct {
+	ChatID int64  `json:"chat"`
+	ID     string `json:"id"`
+
+	// Command, its targets and arguments
+	Command   string `json:"command"`
+	Users     []int  `json:"users"`
+	UntilDate int64  `json:"until,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+
+	// Moderator who issued the command and the message of the command
+	IssuerID  int   `json:"issuer"`
+	MessageID int64 `json:"message"`
+
+	// Message that the command replied to, a warning is recorded with it
+	TargetMessageID int64 `json:"target,omitempty"`
+	// Message to delete once the command was carried out (-d)
+	DeleteMessageID int64 `json:"delete,omitempty"`
+
+	// Time after which the action can not be confirmed anymore
+	Expires int64 `json:"expires"`
+}
+
+// Store is the storage backend used by the rest of the bot.
+type Store interface {
+	// UpdateUserData saves the user details, keyed by the normalized username, and records username and name changes
+	// in the history of the user. The time the user was first seen is kept. The time the user was last seen is saved
+	// with every change, otherwise at most once an hour. Users without a username only get a history.
+	UpdateUserData(User *UserData) error
+
+	// GetUserData looks up a user by username, ignoring the case. It returns nil, nil if the user is unknown.
+	GetUserData(username string) (*UserData, error)
+
+	// GetUserHistory returns the current and past usernames and names of a user. It returns nil, nil if the user is unknown.
+	GetUserHistory(userId int) (*UserHistory, error)
+
+	// AddWarning records a warning, increments the warning counter of the user in the chat and returns the new state.
+	AddWarning(warning *Warning) (*WarnData, error)
+
+	// GetWarnData returns the warning state and history of a user in a chat.
+	GetWarnData(chatId int64, userId int) (*WarnData, error)
+
+	// AddModerationAction records a ban or mute in the warning record of the user in the chat.
+	AddModerationAction(action *ModerationAction) error
+
+	// ResetUserWarn sets the warning counter of a user in a chat to zero. The warning history is kept.
+	ResetUserWarn(chatId int64, userId int) error
+
+	// MigrateLegacyWarns moves the warning counters from the old, chat-independent storage to the chat
+	// and returns the counters it moved, also the ones moved before a failure.
+	MigrateLegacyWarns(chatId int64) ([]LegacyWarn, error)
+
+	// GetChatSettings returns the settings of a chat. Chats without stored settings get the defaults.
+	GetChatSettings(chatId int64) (*ChatSettings, error)
+
+	// UpdateChatSettings saves the settings of a chat.
+	UpdateChatSettings(settings *ChatSettings) error
+
+	// AddPendingAction saves an action that waits for confirmation. Expired actions are removed.
+	AddPendingAction(action *PendingAction) error
+
+	// GetPendingAction returns a pending action of a chat. It returns nil, nil if the action is unknown.
+	// Expired actions may still be returned, the caller checks the expiry.
+	GetPendingAction(chatId int64, id string) (*PendingAction, error)
+
+	// TakePendingAction removes a pending action of a chat and returns it. It returns nil, nil if the action is
+	// not there (anymore): of concurrent calls for the same action only one gets it.
+	TakePendingAction(chatId int64, id string) (*PendingAction, error)
+
+	// AddUpdate records the ID of an incoming update until expires. It returns false if the ID was recorded before,
+	// so an update that Telegram sends again is handled only once. Expired IDs may be removed.
+	AddUpdate(updateId int, expires int64) (bool, error)
+}
+
+// New creates the storage backend selected in the configuration. DynamoDB is used if none is set.
+func New(cfg *config.Config) (Store, error) {
+	switch cfg.Database {
+	case "", BackendDynamoDB:
+		return NewDynamoDBStore(cfg), nil
+	case BackendBolt:
+		return NewBoltStore(cfg.DatabasePath)
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("unknown database backend: %s", cfg.Database)
 }
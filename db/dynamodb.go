@@ -0,0 +1,566 @@
+package db
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/freshautomations/telegram-moderator-bot/config"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Number of times ResetUserWarn tries again when a warning is added at the same time.
+const resetAttempts = 3
+
+// DynamoDBStore keeps the data in the AWS DynamoDB tables tmb-<environment>-users, tmb-<environment>-userids,
+// tmb-<environment>-chatwarns, tmb-<environment>-chats, tmb-<environment>-pending and tmb-<environment>-updates.
+// The chat-independent tmb-<environment>-warns table is only used during migration.
+type DynamoDBStore struct {
+	AWSSession *session.Session
+
+	DDBSession *dynamodb.DynamoDB
+
+	UserTable string
+
+	HistoryTable string
+
+	WarnTable string
+
+	LegacyWarnTable string
+
+	ChatTable string
+
+	PendingTable string
+
+	UpdateTable string
+}
+
+// NewDynamoDBStore sets up the AWS session for the DynamoDB tables of the configured environment.
+func NewDynamoDBStore(cfg *config.Config) *DynamoDBStore {
+	awscfg := aws.Config{
+		Region: aws.String(cfg.AWSRegion),
+	}
+
+	// Use IAM or environment variables credential
+	if (os.Getenv("AWS_ACCESS_KEY_ID") != "" && os.Getenv("AWS_SECRET_ACCESS_KEY") != "") ||
+		(os.Getenv("AWS_ACCESS_KEY") != "" && os.Getenv("AWS_SECRET_KEY") != "") {
+		awscfg.Credentials = credentials.NewEnvCredentials()
+	}
+	s := &DynamoDBStore{
+		AWSSession:      session.Must(session.NewSessionWithOptions(session.Options{Config: awscfg})),
+		UserTable:       "tmb-" + cfg.Environment + "-users",
+		HistoryTable:    "tmb-" + cfg.Environment + "-userids",
+		WarnTable:       "tmb-" + cfg.Environment + "-chatwarns",
+		LegacyWarnTable: "tmb-" + cfg.Environment + "-warns",
+		ChatTable:       "tmb-" + cfg.Environment + "-chats",
+		PendingTable:    "tmb-" + cfg.Environment + "-pending",
+		UpdateTable:     "tmb-" + cfg.Environment + "-updates",
+	}
+	s.DDBSession = dynamodb.New(s.AWSSession)
+	return s
+}
+
+// UpdateUserData writes the users table only when the username or the name changed or lastseen is more than
+// lastSeenInterval old, so lastseen lags behind by at most that much.
+func (s *DynamoDBStore) UpdateUserData(User *UserData) error {
+	history, err := s.GetUserHistory(User.UserID)
+	if err != nil {
+		return err
+	}
+	if history == nil {
+		history = &UserHistory{}
+	}
+	now := time.Now().Unix()
+	previousUsername, changed := history.update(User, now)
+	// Most messages come from users that were seen recently with the same details: only the history is read for them.
+	if !changed {
+		return nil
+	}
+
+	if User.Username != "" {
+		result, err := s.DDBSession.UpdateItem(&dynamodb.UpdateItemInput{
+			ExpressionAttributeNames: map[string]*string{
+				"#userid":    aws.String("id"),
+				"#display":   aws.String("display"),
+				"#name":      aws.String("name"),
+				"#lastseen":  aws.String("lastseen"),
+				"#firstseen": aws.String("firstseen"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":userid": {
+					N: aws.String(strconv.Itoa(User.UserID)),
+				},
+				":display": {
+					S: aws.String(User.Username),
+				},
+				":name": {
+					S: aws.String(User.Name),
+				},
+				":lastseen": {
+					N: aws.String(strconv.FormatInt(now, 10)),
+				},
+				":firstseen": {
+					N: aws.String(strconv.FormatInt(history.FirstSeen, 10)),
+				},
+			},
+			Key:              s.userKey(NormalizeUsername(User.Username)),
+			TableName:        aws.String(s.UserTable),
+			UpdateExpression: aws.String("SET #userid = :userid, #display = :display, #name = :name, #lastseen = :lastseen, #firstseen = if_not_exists(#firstseen, :firstseen)"),
+			ReturnValues:     aws.String("UPDATED_NEW"),
+		})
+		if err != nil {
+			return err
+		}
+
+		// Records written before the history existed know when the user was first seen.
+		if firstSeen := result.Attributes["firstseen"]; firstSeen != nil && firstSeen.N != nil {
+			if value, err := strconv.ParseInt(*firstSeen.N, 10, 64); err == nil && value < history.FirstSeen {
+				history.FirstSeen = value
+				changed = true
+			}
+		}
+	}
+
+	if changed {
+		item, err := dynamodbattribute.MarshalMap(history)
+		if err != nil {
+			return err
+		}
+		_, err = s.DDBSession.PutItem(&dynamodb.PutItemInput{
+			Item:      item,
+			TableName: aws.String(s.HistoryTable),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if previousUsername == "" {
+		return nil
+	}
+	// Drop the records of the old username, unless someone else took it since.
+	for _, key := range usernameKeys(previousUsername) {
+		_, err = s.DDBSession.DeleteItem(&dynamodb.DeleteItemInput{
+			ConditionExpression: aws.String("#userid = :userid"),
+			ExpressionAttributeNames: map[string]*string{
+				"#userid": aws.String("id"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":userid": {
+					N: aws.String(strconv.Itoa(User.UserID)),
+				},
+			},
+			Key:       s.userKey(key),
+			TableName: aws.String(s.UserTable),
+		})
+		if awsError, ok := err.(awserr.Error); ok && awsError.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DynamoDBStore) GetUserData(username string) (*UserData, error) {
+	for _, key := range usernameKeys(username) {
+		result, err := s.DDBSession.GetItem(&dynamodb.GetItemInput{
+			//		ConsistentRead: aws.Bool(true),
+			Key: s.userKey(key),
+			ExpressionAttributeNames: map[string]*string{
+				"#username":  aws.String("username"),
+				"#display":   aws.String("display"),
+				"#userid":    aws.String("id"),
+				"#name":      aws.String("name"),
+				"#firstseen": aws.String("firstseen"),
+			},
+			ProjectionExpression: aws.String("#username, #display, #userid, #name, #firstseen"),
+			TableName:            aws.String(s.UserTable),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		output := UserData{}
+
+		err = dynamodbattribute.UnmarshalMap(result.Item, &output)
+		if err != nil {
+			return nil, err
+		}
+
+		// The key is the normalized username, the display attribute keeps it as the user wrote it.
+		if display := result.Item["display"]; display != nil && display.S != nil {
+			output.Username = *display.S
+		}
+		if output.UserID != 0 {
+			return &output, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *DynamoDBStore) GetUserHistory(userId int) (*UserHistory, error) {
+	result, err := s.DDBSession.GetItem(&dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				N: aws.String(strconv.Itoa(userId)),
+			},
+		},
+		TableName: aws.String(s.HistoryTable),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+
+	output := &UserHistory{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, output)
+	return output, err
+}
+
+// userKey is the primary key of a user's record in the users table.
+func (s *DynamoDBStore) userKey(username string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"username": {
+			S: aws.String(username),
+		},
+	}
+}
+
+func (s *DynamoDBStore) AddWarning(warning *Warning) (*WarnData, error) {
+	item, err := dynamodbattribute.MarshalMap(warning)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.DDBSession.UpdateItem(&dynamodb.UpdateItemInput{
+		ExpressionAttributeNames: map[string]*string{
+			"#warn":     aws.String("warn"),
+			"#warnings": aws.String("warnings"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":warn": {
+				N: aws.String("1"),
+			},
+			":warning": {
+				L: []*dynamodb.AttributeValue{{M: item}},
+			},
+			":empty": {
+				L: []*dynamodb.AttributeValue{},
+			},
+		},
+		Key:              s.warnKey(warning.ChatID, warning.UserID),
+		TableName:        aws.String(s.WarnTable),
+		UpdateExpression: aws.String("ADD #warn :warn SET #warnings = list_append(if_not_exists(#warnings, :empty), :warning)"),
+		ReturnValues:     aws.String("ALL_NEW"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output := &WarnData{}
+	err = dynamodbattribute.UnmarshalMap(result.Attributes, output)
+	return output, err
+}
+
+func (s *DynamoDBStore) GetWarnData(chatId int64, userId int) (*WarnData, error) {
+	result, err := s.DDBSession.GetItem(&dynamodb.GetItemInput{
+		Key: s.warnKey(chatId, userId),
+		ExpressionAttributeNames: map[string]*string{
+			"#warn":       aws.String("warn"),
+			"#reset":      aws.String("reset"),
+			"#resetindex": aws.String("resetindex"),
+			"#warnings":   aws.String("warnings"),
+			"#actions":    aws.String("actions"),
+		},
+		ProjectionExpression: aws.String("#warn, #reset, #resetindex, #warnings, #actions"),
+		TableName:            aws.String(s.WarnTable),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output := &WarnData{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, output)
+	return output, err
+}
+
+func (s *DynamoDBStore) AddModerationAction(action *ModerationAction) error {
+	item, err := dynamodbattribute.MarshalMap(action)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DDBSession.UpdateItem(&dynamodb.UpdateItemInput{
+		ExpressionAttributeNames: map[string]*string{
+			"#actions": aws.String("actions"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":action": {
+				L: []*dynamodb.AttributeValue{{M: item}},
+			},
+			":empty": {
+				L: []*dynamodb.AttributeValue{},
+			},
+		},
+		Key:              s.warnKey(action.ChatID, action.UserID),
+		TableName:        aws.String(s.WarnTable),
+		UpdateExpression: aws.String("SET #actions = list_append(if_not_exists(#actions, :empty), :action)"),
+	})
+	return err
+}
+
+// ResetUserWarn records the length of the warning history with the reset. The write fails if a warning was added
+// since the history was read, then the reset is tried again.
+func (s *DynamoDBStore) ResetUserWarn(chatId int64, userId int) (err error) {
+	for attempt := 0; attempt < resetAttempts; attempt++ {
+		var record *WarnData
+		if record, err = s.GetWarnData(chatId, userId); err != nil {
+			return
+		}
+
+		condition := "size(#warnings) = :resetindex"
+		if len(record.Warnings) == 0 {
+			condition = "attribute_not_exists(#warnings)"
+		}
+		_, err = s.DDBSession.UpdateItem(&dynamodb.UpdateItemInput{
+			ConditionExpression: aws.String(condition),
+			ExpressionAttributeNames: map[string]*string{
+				"#warn":       aws.String("warn"),
+				"#reset":      aws.String("reset"),
+				"#resetindex": aws.String("resetindex"),
+				"#warnings":   aws.String("warnings"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":warn": {
+					N: aws.String("0"),
+				},
+				":reset": {
+					N: aws.String(strconv.FormatInt(time.Now().Unix(), 10)),
+				},
+				":resetindex": {
+					N: aws.String(strconv.Itoa(len(record.Warnings))),
+				},
+			},
+			Key:              s.warnKey(chatId, userId),
+			TableName:        aws.String(s.WarnTable),
+			UpdateExpression: aws.String("SET #warn = :warn, #reset = :reset, #resetindex = :resetindex"),
+		})
+		if awsError, ok := err.(awserr.Error); !ok || awsError.Code() != dynamodb.ErrCodeConditionalCheckFailedException {
+			return
+		}
+	}
+	return
+}
+
+// MigrateLegacyWarns adds the counters of the legacy warns table to the chat and removes them from the legacy table.
+func (s *DynamoDBStore) MigrateLegacyWarns(chatId int64) (migrated []LegacyWarn, err error) {
+	var legacy []LegacyWarn
+
+	err = s.DDBSession.ScanPages(&dynamodb.ScanInput{
+		TableName: aws.String(s.LegacyWarnTable),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			record := LegacyWarn{}
+			if err = dynamodbattribute.UnmarshalMap(item, &record); err != nil {
+				return false
+			}
+			legacy = append(legacy, record)
+		}
+		return true
+	})
+	if err != nil {
+		return
+	}
+
+	for _, record := range legacy {
+		if record.Warn > 0 {
+			_, err = s.DDBSession.UpdateItem(&dynamodb.UpdateItemInput{
+				ExpressionAttributeNames: map[string]*string{
+					"#warn": aws.String("warn"),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":warn": {
+						N: aws.String(strconv.Itoa(record.Warn)),
+					},
+				},
+				Key:              s.warnKey(chatId, record.UserID),
+				TableName:        aws.String(s.WarnTable),
+				UpdateExpression: aws.String("ADD #warn :warn"),
+			})
+			if err != nil {
+				return
+			}
+			migrated = append(migrated, record)
+		}
+
+		_, err = s.DDBSession.DeleteItem(&dynamodb.DeleteItemInput{
+			Key: map[string]*dynamodb.AttributeValue{
+				"id": {
+					N: aws.String(strconv.Itoa(record.UserID)),
+				},
+			},
+			TableName: aws.String(s.LegacyWarnTable),
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (s *DynamoDBStore) GetChatSettings(chatId int64) (*ChatSettings, error) {
+	result, err := s.DDBSession.GetItem(&dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"chat": {
+				N: aws.String(strconv.FormatInt(chatId, 10)),
+			},
+		},
+		TableName: aws.String(s.ChatTable),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output := &ChatSettings{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, output)
+	output.ChatID = chatId
+	return output, err
+}
+
+func (s *DynamoDBStore) UpdateChatSettings(settings *ChatSettings) error {
+	item, err := dynamodbattribute.MarshalMap(settings)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DDBSession.PutItem(&dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(s.ChatTable),
+	})
+	return err
+}
+
+// AddPendingAction saves the action. Expired actions are removed by the time to live of the table.
+func (s *DynamoDBStore) AddPendingAction(action *PendingAction) error {
+	item, err := dynamodbattribute.MarshalMap(action)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DDBSession.PutItem(&dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(s.PendingTable),
+	})
+	return err
+}
+
+func (s *DynamoDBStore) GetPendingAction(chatId int64, id string) (*PendingAction, error) {
+	result, err := s.DDBSession.GetItem(&dynamodb.GetItemInput{
+		ConsistentRead: aws.Bool(true),
+		Key:            s.pendingKey(chatId, id),
+		TableName:      aws.String(s.PendingTable),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+
+	output := &PendingAction{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, output)
+	return output, err
+}
+
+// TakePendingAction deletes the action only if it still exists, so of concurrent calls only one gets the old item.
+func (s *DynamoDBStore) TakePendingAction(chatId int64, id string) (*PendingAction, error) {
+	result, err := s.DDBSession.DeleteItem(&dynamodb.DeleteItemInput{
+		ConditionExpression: aws.String("attribute_exists(#id)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id": aws.String("id"),
+		},
+		Key:          s.pendingKey(chatId, id),
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+		TableName:    aws.String(s.PendingTable),
+	})
+	if awsError, ok := err.(awserr.Error); ok && awsError.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Attributes) == 0 {
+		return nil, nil
+	}
+
+	output := &PendingAction{}
+	err = dynamodbattribute.UnmarshalMap(result.Attributes, output)
+	return output, err
+}
+
+// AddUpdate records the update ID unless it is there already. Expired IDs are removed by the time to live of the table,
+// which can take a while, so they are overwritten until then.
+func (s *DynamoDBStore) AddUpdate(updateId int, expires int64) (bool, error) {
+	_, err := s.DDBSession.PutItem(&dynamodb.PutItemInput{
+		ConditionExpression: aws.String("attribute_not_exists(#id) OR #expires < :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id":      aws.String("id"),
+			"#expires": aws.String("expires"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {
+				N: aws.String(strconv.FormatInt(time.Now().Unix(), 10)),
+			},
+		},
+		Item: map[string]*dynamodb.AttributeValue{
+			"id": {
+				N: aws.String(strconv.Itoa(updateId)),
+			},
+			"expires": {
+				N: aws.String(strconv.FormatInt(expires, 10)),
+			},
+		},
+		TableName: aws.String(s.UpdateTable),
+	})
+	if awsError, ok := err.(awserr.Error); ok && awsError.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// pendingKey is the primary key of an action in the pending table.
+func (s *DynamoDBStore) pendingKey(chatId int64, id string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"chat": {
+			N: aws.String(strconv.FormatInt(chatId, 10)),
+		},
+		"id": {
+			S: aws.String(id),
+		},
+	}
+}
+
+// warnKey is the primary key of a user's record in the warns table.
+func (s *DynamoDBStore) warnKey(chatId int64, userId int) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"chat": {
+			N: aws.String(strconv.FormatInt(chatId, 10)),
+		},
+		"id": {
+			N: aws.String(strconv.Itoa(userId)),
+		},
+	}
+}
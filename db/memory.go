@@ -0,0 +1,215 @@
+package db
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the data in memory. Everything is lost when the bot stops. Useful for tests and local runs.
+type MemoryStore struct {
+	mutex   sync.Mutex
+	users   map[string]UserData
+	history map[int]UserHistory
+	warns   map[memoryWarnKey]*WarnData
+	chats   map[int64]ChatSettings
+	pending map[memoryPendingKey]PendingAction
+	updates map[int]int64
+}
+
+// memoryWarnKey is the key of a user's warning counter in a chat.
+type memoryWarnKey struct {
+	ChatId int64
+	UserId int
+}
+
+// memoryPendingKey is the key of a pending action in a chat.
+type memoryPendingKey struct {
+	ChatId int64
+	Id     string
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:   make(map[string]UserData),
+		history: make(map[int]UserHistory),
+		warns:   make(map[memoryWarnKey]*WarnData),
+		chats:   make(map[int64]ChatSettings),
+		pending: make(map[memoryPendingKey]PendingAction),
+		updates: make(map[int]int64),
+	}
+}
+
+func (s *MemoryStore) UpdateUserData(User *UserData) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	history := s.history[User.UserID]
+	previousUsername, _ := history.update(User, time.Now().Unix())
+	s.history[User.UserID] = history
+
+	if previous, ok := s.users[NormalizeUsername(previousUsername)]; ok && previousUsername != "" && previous.UserID == User.UserID {
+		delete(s.users, NormalizeUsername(previousUsername))
+	}
+	if User.Username != "" {
+		stored := *User
+		stored.FirstSeen = history.FirstSeen
+		s.users[NormalizeUsername(User.Username)] = stored
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetUserData(username string) (*UserData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	user, ok := s.users[NormalizeUsername(username)]
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+func (s *MemoryStore) GetUserHistory(userId int) (*UserHistory, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	history, ok := s.history[userId]
+	if !ok {
+		return nil, nil
+	}
+	history.Usernames = append([]*NameChange(nil), history.Usernames...)
+	history.Names = append([]*NameChange(nil), history.Names...)
+	return &history, nil
+}
+
+func (s *MemoryStore) AddWarning(warning *Warning) (*WarnData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	record := s.warnData(warning.ChatID, warning.UserID)
+	stored := *warning
+	record.Warn++
+	record.Warnings = append(record.Warnings, &stored)
+	return copyWarnData(record), nil
+}
+
+func (s *MemoryStore) GetWarnData(chatId int64, userId int) (*WarnData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return copyWarnData(s.warnData(chatId, userId)), nil
+}
+
+func (s *MemoryStore) AddModerationAction(action *ModerationAction) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	record := s.warnData(action.ChatID, action.UserID)
+	stored := *action
+	record.Actions = append(record.Actions, &stored)
+	return nil
+}
+
+func (s *MemoryStore) ResetUserWarn(chatId int64, userId int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	record := s.warnData(chatId, userId)
+	record.Warn = 0
+	record.Reset = time.Now().Unix()
+	record.ResetIndex = len(record.Warnings)
+	return nil
+}
+
+// warnData returns the warning record of a user in a chat, creating it if needed. The mutex must be held.
+func (s *MemoryStore) warnData(chatId int64, userId int) *WarnData {
+	key := memoryWarnKey{chatId, userId}
+	if s.warns[key] == nil {
+		s.warns[key] = &WarnData{}
+	}
+	return s.warns[key]
+}
+
+func (s *MemoryStore) GetChatSettings(chatId int64) (*ChatSettings, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	settings, ok := s.chats[chatId]
+	if !ok {
+		return &ChatSettings{ChatID: chatId}, nil
+	}
+	return &settings, nil
+}
+
+func (s *MemoryStore) UpdateChatSettings(settings *ChatSettings) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.chats[settings.ChatID] = *settings
+	return nil
+}
+
+// copyWarnData copies a warning record, so callers can not change the stored data.
+func copyWarnData(record *WarnData) *WarnData {
+	output := &WarnData{Warn: record.Warn, Reset: record.Reset, ResetIndex: record.ResetIndex}
+	for _, warning := range record.Warnings {
+		stored := *warning
+		output.Warnings = append(output.Warnings, &stored)
+	}
+	for _, action := range record.Actions {
+		stored := *action
+		output.Actions = append(output.Actions, &stored)
+	}
+	return output
+}
+
+// MigrateLegacyWarns does nothing: the memory backend never had chat-independent warnings.
+func (s *MemoryStore) MigrateLegacyWarns(chatId int64) ([]LegacyWarn, error) {
+	return nil, nil
+}
+
+func (s *MemoryStore) AddPendingAction(action *PendingAction) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now().Unix()
+	for key, pending := range s.pending {
+		if pending.Expires < now {
+			delete(s.pending, key)
+		}
+	}
+	stored := *action
+	stored.Users = append([]int(nil), action.Users...)
+	s.pending[memoryPendingKey{action.ChatID, action.ID}] = stored
+	return nil
+}
+
+func (s *MemoryStore) GetPendingAction(chatId int64, id string) (*PendingAction, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	action, ok := s.pending[memoryPendingKey{chatId, id}]
+	if !ok {
+		return nil, nil
+	}
+	action.Users = append([]int(nil), action.Users...)
+	return &action, nil
+}
+
+func (s *MemoryStore) TakePendingAction(chatId int64, id string) (*PendingAction, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := memoryPendingKey{chatId, id}
+	action, ok := s.pending[key]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.pending, key)
+	return &action, nil
+}
+
+func (s *MemoryStore) AddUpdate(updateId int, expires int64) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now().Unix()
+	for id, until := range s.updates {
+		if until < now {
+			delete(s.updates, id)
+		}
+	}
+	if _, ok := s.updates[updateId]; ok {
+		return false, nil
+	}
+	s.updates[updateId] = expires
+	return true, nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// Longest list of past usernames or names kept for a user.
+const maxHistory = 20
+
+// Time after which the bot records again that it saw a user whose details did not change. Saving the user on every
+// message would cost a write per message.
+const lastSeenInterval = time.Hour
+
+// NameChange is a past username or name of a user.
+type NameChange struct {
+	Value string `json:"value"`
+
+	// Time the bot noticed the change
+	Until int64 `json:"until"`
+}
+
+// UserHistory holds the current and the past usernames and names of a user, keyed by user ID.
+type UserHistory struct {
+	UserID   int    `json:"id"`
+	Username string `json:"username,omitempty"`
+	Name     string `json:"name"`
+
+	// Time the bot first saw the user
+	FirstSeen int64 `json:"firstseen"`
+	// Time the bot last saw the user, at most lastSeenInterval old
+	LastSeen int64 `json:"lastseen,omitempty"`
+
+	// Past usernames and names, oldest first
+	Usernames []*NameChange `json:"usernames,omitempty"`
+	Names     []*NameChange `json:"names,omitempty"`
+}
+
+// NormalizeUsername returns the key of a username. Telegram usernames are case-insensitive.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimPrefix(username, "@"))
+}
+
+// update applies the current details of the user to the history. It returns the previous username if the user
+// changed it, and whether the history has to be saved: when the details changed or LastSeen is older than lastSeenInterval.
+func (h *UserHistory) update(User *UserData, now int64) (previousUsername string, changed bool) {
+	if h.UserID == 0 {
+		h.UserID = User.UserID
+		h.FirstSeen = now
+		changed = true
+	}
+
+	if h.Username != User.Username {
+		if h.Username != "" && NormalizeUsername(h.Username) != NormalizeUsername(User.Username) {
+			previousUsername = h.Username
+			h.Usernames = appendNameChange(h.Usernames, h.Username, now)
+		}
+		h.Username = User.Username
+		changed = true
+	}
+
+	if h.Name != User.Name {
+		if h.Name != "" {
+			h.Names = appendNameChange(h.Names, h.Name, now)
+		}
+		h.Name = User.Name
+		changed = true
+	}
+
+	if changed || now-h.LastSeen >= int64(lastSeenInterval/time.Second) {
+		h.LastSeen = now
+		changed = true
+	}
+	return
+}
+
+// appendNameChange adds a past value to the list and drops the oldest ones above maxHistory.
+func appendNameChange(changes []*NameChange, value string, now int64) []*NameChange {
+	changes = append(changes, &NameChange{Value: value, Until: now})
+	if len(changes) > maxHistory {
+		changes = changes[len(changes)-maxHistory:]
+	}
+	return changes
+}
+
+// usernameKeys returns the keys a username might be stored under: the normalized one and, for records written
+// before the keys were normalized, the username as it was written.
+func usernameKeys(username string) []string {
+	keys := []string{NormalizeUsername(username)}
+	if username != keys[0] {
+		keys = append(keys, username)
+	}
+	return keys
+}
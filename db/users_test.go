@@ -0,0 +1,38 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateLastSeen(t *testing.T) {
+	interval := int64(lastSeenInterval / time.Second)
+	const seen = 1600000000
+	user := &UserData{Username: "Alice", UserID: 1, Name: "Alice"}
+
+	tests := []struct {
+		name         string
+		history      UserHistory
+		user         *UserData
+		now          int64
+		wantChanged  bool
+		wantLastSeen int64
+	}{
+		{"new user", UserHistory{}, user, seen, true, seen},
+		{"seen recently", UserHistory{UserID: 1, Username: "Alice", Name: "Alice", FirstSeen: seen, LastSeen: seen}, user, seen + interval - 1, false, seen},
+		{"seen long ago", UserHistory{UserID: 1, Username: "Alice", Name: "Alice", FirstSeen: seen, LastSeen: seen}, user, seen + interval, true, seen + interval},
+		{"name changed", UserHistory{UserID: 1, Username: "Alice", Name: "Al", FirstSeen: seen, LastSeen: seen}, user, seen + 1, true, seen + 1},
+		{"history without lastseen", UserHistory{UserID: 1, Username: "Alice", Name: "Alice", FirstSeen: seen}, user, seen + 1, true, seen + 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history := test.history
+			if _, changed := history.update(test.user, test.now); changed != test.wantChanged {
+				t.Errorf("update() changed = %t; want %t", changed, test.wantChanged)
+			}
+			if history.LastSeen != test.wantLastSeen {
+				t.Errorf("LastSeen = %d; want %d", history.LastSeen, test.wantLastSeen)
+			}
+		})
+	}
+}
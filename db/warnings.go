@@ -0,0 +1,73 @@
+package db
+
+import (
+	"time"
+)
+
+// ActiveWarning is a warning that still counts towards a ban.
+type ActiveWarning struct {
+	*Warning
+
+	// Time when the warning stops counting. Zero if it never expires.
+	Expires int64
+}
+
+// Active lists the warnings that count at the given time, oldest first, with their expiry time.
+// Legacy is the number of warnings issued before the warning history existed. Those never expire.
+func (w *WarnData) Active(settings *ChatSettings, now time.Time) (active []*ActiveWarning, legacy int) {
+	var current []*Warning
+	for i, warning := range w.Warnings {
+		// Dates are stored in seconds, the index tells apart the warnings issued in the second of the reset.
+		if i >= w.ResetIndex && warning.Date >= w.Reset {
+			current = append(current, warning)
+		}
+	}
+
+	legacy = w.Warn - len(current)
+	if legacy < 0 {
+		legacy = 0
+	}
+
+	expires := make([]int64, len(current))
+	if settings.WarnExpiry > 0 {
+		for i, warning := range current {
+			expires[i] = warning.Date + settings.WarnExpiry
+		}
+	}
+	if settings.WarnDecay > 0 {
+		for i, decay := range decayTimes(current, settings.WarnDecay) {
+			if expires[i] == 0 || decay < expires[i] {
+				expires[i] = decay
+			}
+		}
+	}
+
+	for i, warning := range current {
+		if expires[i] == 0 || expires[i] > now.Unix() {
+			active = append(active, &ActiveWarning{warning, expires[i]})
+		}
+	}
+	return
+}
+
+// Count returns the number of warnings that count at the given time.
+func (w *WarnData) Count(settings *ChatSettings, now time.Time) int {
+	active, legacy := w.Active(settings, now)
+	return len(active) + legacy
+}
+
+// decayTimes calculates when each warning decays if one warning, the oldest one, is removed every decay seconds.
+// The clock of a warning starts when it is issued or when the warning before it decays, whichever is later.
+func decayTimes(warnings []*Warning, decay int64) []int64 {
+	result := make([]int64, len(warnings))
+	var last int64
+	for i, warning := range warnings {
+		start := warning.Date
+		if last > start {
+			start = last
+		}
+		last = start + decay
+		result[i] = last
+	}
+	return result
+}
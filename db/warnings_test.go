@@ -0,0 +1,67 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestActiveReset(t *testing.T) {
+	now := time.Unix(1000, 0)
+	settings := &ChatSettings{}
+	warnings := []*Warning{{Date: 900}, {Date: 1000}, {Date: 1000}}
+
+	tests := []struct {
+		name   string
+		record *WarnData
+		want   int
+	}{
+		{"no reset", &WarnData{Warn: 3, Warnings: warnings}, 3},
+		{"reset in the second of a warning", &WarnData{Warn: 1, Reset: 1000, ResetIndex: 2, Warnings: warnings}, 1},
+		{"reset after every warning", &WarnData{Warn: 0, Reset: 1000, ResetIndex: 3, Warnings: warnings}, 0},
+		{"reset recorded without an index", &WarnData{Warn: 0, Reset: 950, Warnings: warnings}, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.record.Count(settings, now); got != test.want {
+				t.Errorf("Count() = %d; want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// A warning issued in the same second before a reset must not survive it, in every backend that can run locally.
+func TestResetUserWarnSameSecond(t *testing.T) {
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "tmb.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.DB.Close()
+
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "bolt": bolt} {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			if _, err := store.AddWarning(&Warning{ChatID: 1, UserID: 2, Date: now.Unix()}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.ResetUserWarn(1, 2); err != nil {
+				t.Fatal(err)
+			}
+			record, err := store.GetWarnData(1, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := record.Count(&ChatSettings{}, now); got != 0 {
+				t.Errorf("Count() after reset = %d; want 0", got)
+			}
+
+			record, err = store.AddWarning(&Warning{ChatID: 1, UserID: 2, Date: now.Unix()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := record.Count(&ChatSettings{}, now); got != 1 {
+				t.Errorf("Count() after a new warning = %d; want 1", got)
+			}
+		})
+	}
+}
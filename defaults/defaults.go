@@ -1,6 +1,8 @@
 // Default package implements versioning primitives.
 package defaults
 
+import "time"
+
 // Major version number.
 const Major = "0"
 
@@ -19,8 +21,66 @@ const ContentType = "application/json; charset=utf8"
 // Telegram API base URL
 const TelegramAPIBase string = "https://api.telegram.org/bot"
 
-// Number of warns before a ban is issued. Todo: make it parameterized.
-const WarnLimit = 2
+// HTTP header that holds the secret token of the webhook in the requests of Telegram.
+const WebhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Number of simultaneous webhook connections Telegram opens to the bot.
+const WebhookMaxConnections = 10
+
+// Timeout of a Telegram API call, including reading the response. The Lambda function makes several calls
+// for one update, so a call gets only a part of its timeout.
+const TelegramTimeout = 4 * time.Second
+
+// Time Telegram waits for new updates in a getUpdates call in polling mode.
+const PollTimeout = 50 * time.Second
+
+// Wait after a failed getUpdates call in polling mode.
+const PollRetryWait = 5 * time.Second
+
+// Time the ID of a webhook update is remembered, so an update that Telegram sends again is handled only once.
+// Telegram stops resending an update long before that.
+const UpdateRetention = 24 * time.Hour
+
+// Number of times a failed Telegram API call is retried.
+const TelegramRetries = 3
+
+// Wait before the first retry of a Telegram API call. It doubles with each retry.
+const TelegramRetryBackoff = 500 * time.Millisecond
+
+// Longest time a Telegram API call waits in total for retries and the message throttle, when polling and in subcommands.
+// Calls that would wait longer fail. In webhook mode the wait is derived from the timeout of the function instead.
+const TelegramMaxWait = 30 * time.Second
+
+// Time the bot has to answer an update in webhook mode, if TIMEOUT is not set. It matches the Lambda function default.
+const WebhookTimeout = 15 * time.Second
+
+// Part of the webhook timeout kept for the API calls themselves, a call waits at most for the rest.
+// At least half of the timeout is kept, whatever the timeout is.
+const WebhookTimeoutMargin = 5 * time.Second
+
+// Messages sent to a group per minute. Telegram drops the messages above 20.
+const TelegramChatMessageLimit = 20
+
+// Messages sent per second across all chats. Telegram allows about 30.
+const TelegramGlobalMessageLimit = 30
+
+// Messages deleted in one deleteMessages call. Telegram accepts at most 100.
+const TelegramDeleteMessagesLimit = 100
+
+// Most messages that one /purge command deletes.
+const PurgeLimit = 1000
+
+// Shortest time Telegram accepts for a temporary ban or mute. Shorter ones are permanent.
+const MinRestrictDuration = 30 * time.Second
+
+// Longest time Telegram accepts for a temporary ban or mute. Longer ones are permanent.
+const MaxRestrictDuration = 366 * 24 * time.Hour
+
+// Escalation policy used when neither the chat settings nor the configuration sets one: ban at the second warning.
+const Escalation = "note,ban"
+
+// Time a moderator has to confirm a moderation command that needs confirmation.
+const ConfirmationTimeout = 5 * time.Minute
 
 // Debug messages
 const Debug = false
@@ -0,0 +1,92 @@
+// Duration package parses and formats the human-friendly durations used in bot commands, like 30m, 12h, 7d or 1w.
+package duration
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Day is the length of a day. The bot does not care about daylight saving time.
+const Day = 24 * time.Hour
+
+// Week is the length of a week.
+const Week = 7 * Day
+
+// units lists the accepted unit suffixes, largest first.
+var units = []struct {
+	Suffix   string
+	Duration time.Duration
+}{
+	{"w", Week},
+	{"d", Day},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+}
+
+// ErrInvalid is returned when a string is not a valid duration.
+var ErrInvalid = errors.New("invalid duration, use a number with a unit: s, m, h, d or w (for example: 30m, 12h, 7d, 1w or 1d12h)")
+
+// Parse converts a string like 30m, 12h, 7d, 1w or 1d12h to a time.Duration.
+func Parse(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, ErrInvalid
+	}
+
+	var result time.Duration
+	for s != "" {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(s) {
+			return 0, ErrInvalid
+		}
+		number, err := strconv.ParseInt(s[:i], 10, 64)
+		if err != nil {
+			return 0, ErrInvalid
+		}
+
+		unit := time.Duration(0)
+		for _, u := range units {
+			if s[i:i+1] == u.Suffix {
+				unit = u.Duration
+				break
+			}
+		}
+		if unit == 0 {
+			return 0, ErrInvalid
+		}
+
+		if time.Duration(number) > (math.MaxInt64-result)/unit {
+			return 0, ErrInvalid
+		}
+		result += time.Duration(number) * unit
+		s = s[i+1:]
+	}
+
+	if result <= 0 {
+		return 0, ErrInvalid
+	}
+	return result, nil
+}
+
+// Format converts a time.Duration to the format accepted by Parse. Sub-second precision is dropped.
+func Format(d time.Duration) string {
+	if d < time.Second {
+		return "0s"
+	}
+
+	var result string
+	for _, u := range units {
+		if d >= u.Duration {
+			result += strconv.FormatInt(int64(d/u.Duration), 10) + u.Suffix
+			d %= u.Duration
+		}
+	}
+	return result
+}
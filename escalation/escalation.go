@@ -0,0 +1,107 @@
+// Escalation package defines the policy that decides what happens to a user after a warning.
+//
+// A policy is written as a comma-separated list of steps, one for each warning. For example
+// "note,mute:1h,mute:1d,ban" means: the first warning is only a note, the second one mutes the user
+// for an hour, the third one mutes the user for a day and the fourth one bans the user.
+// Bans can be temporary too, like "ban:7d".
+// Further warnings repeat the last step.
+package escalation
+
+import (
+	"fmt"
+	"github.com/freshautomations/telegram-moderator-bot/defaults"
+	"github.com/freshautomations/telegram-moderator-bot/duration"
+	"strings"
+	"time"
+)
+
+// Actions that a step can take.
+const (
+	Note = "note"
+	Mute = "mute"
+	Ban  = "ban"
+)
+
+// Step is the action taken at a given warning. Duration is zero for permanent actions.
+type Step struct {
+	Action   string
+	Duration time.Duration
+}
+
+// Policy is the list of steps, the first one belongs to the first warning.
+type Policy []Step
+
+// Parse converts a comma-separated list of steps like "note,mute:1h,ban" into a Policy.
+func Parse(s string) (Policy, error) {
+	var policy Policy
+	for _, item := range strings.Split(s, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		parts := strings.SplitN(item, ":", 2)
+		step := Step{Action: parts[0]}
+
+		switch step.Action {
+		case Note:
+			if len(parts) > 1 {
+				return nil, fmt.Errorf("%s does not take a duration: %s", step.Action, item)
+			}
+		case Mute, Ban:
+			if len(parts) > 1 {
+				d, err := duration.Parse(parts[1])
+				if err != nil {
+					return nil, err
+				}
+				if d < defaults.MinRestrictDuration || d > defaults.MaxRestrictDuration {
+					return nil, fmt.Errorf("%s duration must be between %s and %s: %s", step.Action,
+						duration.Format(defaults.MinRestrictDuration), duration.Format(defaults.MaxRestrictDuration), item)
+				}
+				step.Duration = d
+			}
+		default:
+			return nil, fmt.Errorf("unknown escalation step: %s (use %s, %s, %s:duration, %s or %s:duration)", item, Note, Mute, Mute, Ban, Ban)
+		}
+
+		policy = append(policy, step)
+	}
+	return policy, nil
+}
+
+// Step returns the step that belongs to the given number of active warnings.
+func (p Policy) Step(warnings int) Step {
+	if warnings < 1 || len(p) == 0 {
+		return Step{Action: Note}
+	}
+	if warnings > len(p) {
+		return p[len(p)-1]
+	}
+	return p[warnings-1]
+}
+
+// String converts the Policy back to the format accepted by Parse.
+func (p Policy) String() string {
+	var steps []string
+	for _, step := range p {
+		if step.Duration > 0 {
+			steps = append(steps, step.Action+":"+duration.Format(step.Duration))
+		} else {
+			steps = append(steps, step.Action)
+		}
+	}
+	return strings.Join(steps, ",")
+}
+
+// String describes the step for messages.
+func (s Step) String() string {
+	switch s.Action {
+	case Mute:
+		if s.Duration > 0 {
+			return "muted for " + duration.Format(s.Duration)
+		}
+		return "muted"
+	case Ban:
+		if s.Duration > 0 {
+			return "banned for " + duration.Format(s.Duration)
+		}
+		return "banned"
+	}
+	return "noted"
+}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/aws/aws-lambda-go/events"
@@ -14,15 +15,22 @@ import (
 	"github.com/freshautomations/telegram-moderator-bot/context"
 	"github.com/freshautomations/telegram-moderator-bot/db"
 	"github.com/freshautomations/telegram-moderator-bot/defaults"
+	"github.com/freshautomations/telegram-moderator-bot/escalation"
+	"github.com/freshautomations/telegram-moderator-bot/telegram"
 	"log"
 	"net/http"
 	"os/signal"
+	"regexp"
+	"strings"
 	"syscall"
 
 	"os"
 	"time"
 )
 
+// Characters Telegram accepts in the secret token of a webhook.
+var webhookSecretPattern = regexp.MustCompile("^[A-Za-z0-9_-]{1,256}$")
+
 // lambdaInitialized is an indicator that tells if the AWS Lambda function is in the startup phase.
 var lambdaInitialized = false
 
@@ -38,6 +46,9 @@ func LambdaHandler(req events.APIGatewayProxyRequest) (events.APIGatewayProxyRes
 
 		var err error
 		ctx, err := Initialization(context.NewInitialContext())
+		if err == nil {
+			err = requireWebhookSecret(ctx)
+		}
 		if err != nil {
 			log.Printf("[init] initialization failed: %v", err)
 			errbody, _ := json.Marshal(context.ErrorMessage{
@@ -67,6 +78,9 @@ func WebserverHandler(localCtx *context.InitialContext) {
 
 	var err error
 	ctx, err := Initialization(localCtx)
+	if err == nil {
+		err = requireWebhookSecret(ctx)
+	}
 	if err != nil {
 		log.Fatalf("initialization failed: %v\n", err)
 	}
@@ -82,45 +96,200 @@ func WebserverHandler(localCtx *context.InitialContext) {
 		Handler:      r,
 	}
 
-	var gracefulStop = make(chan os.Signal)
-	signal.Notify(gracefulStop, syscall.SIGTERM)
-	signal.Notify(gracefulStop, syscall.SIGINT)
-	go func() {
-		sig := <-gracefulStop
-		log.Printf("[final] caught signal: %+v", sig)
-		log.Print("[final] waiting 2 seconds to finish processing")
-		time.Sleep(2 * time.Second)
-		os.Exit(0)
-	}()
+	handleSignals()
 
 	if err := srv.ListenAndServe(); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// PollHandler is the function that is called when the `--poll` parameter is invoked.
+// It fetches the updates with getUpdates instead of receiving them through the webhook, so no public endpoint is needed.
+func PollHandler(localCtx *context.InitialContext) {
+	log.Printf("[init] polling start %s", defaults.Version)
+
+	ctx, err := Initialization(localCtx)
+	if err != nil {
+		log.Fatalf("initialization failed: %v\n", err)
+	}
+
+	handleSignals()
+
+	// Long polling keeps the request open, the HTTP client has to wait for it.
+	poller := *ctx.Telegram
+	poller.HTTPClient = &http.Client{Timeout: defaults.PollTimeout + defaults.TelegramTimeout}
+
+	offset := 0
+	for {
+		updates, err := poller.GetUpdates(offset, int(defaults.PollTimeout/time.Second), handledUpdates)
+		if err != nil {
+			if apiError, ok := err.(*telegram.APIError); ok && apiError.Code == http.StatusConflict {
+				log.Fatalf("polling failed, remove the webhook of the bot first: %v\n", err)
+			}
+			log.Printf("[error] GetUpdates: %v", err)
+			time.Sleep(defaults.PollRetryWait)
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateId + 1
+			if err := ProcessUpdate(ctx, update); err != nil {
+				log.Printf("[error] ProcessUpdate %d: %v", update.UpdateId, err)
+			}
+		}
+	}
+}
+
+// SubcommandHandler runs the `webhook set|delete|info`, `commands set|delete` and `getme` subcommands.
+// They only need the Telegram token.
+// The configuration is read from the config file, or from environment variables if the config file is set to "".
+func SubcommandHandler(localCtx *context.InitialContext, args []string) {
+	cfg, err := loadConfig(localCtx)
+	if err != nil {
+		log.Fatalf("loading config failed: %v\n", err)
+	}
+	client := telegram.NewClient(cfg.TelegramAPI, cfg.TelegramToken)
+
+	subcommand := args[0]
+	if len(args) > 1 {
+		subcommand = args[0] + " " + args[1]
+	}
+
+	switch subcommand {
+	case "webhook set":
+		if len(args) != 3 {
+			log.Fatal("usage: tmb webhook set <url>")
+		}
+		if !webhookSecretPattern.MatchString(cfg.WebhookSecret) {
+			log.Fatal("WEBHOOKSECRET must be set to 1-256 characters of A-Z, a-z, 0-9, _ and -")
+		}
+		err = client.SetWebhook(args[2], cfg.WebhookSecret, handledUpdates, defaults.WebhookMaxConnections)
+		if err == nil {
+			log.Printf("[final] webhook set to %s for %s", args[2], strings.Join(handledUpdates, ", "))
+		}
+	case "webhook delete":
+		err = client.DeleteWebhook()
+		if err == nil {
+			log.Print("[final] webhook deleted")
+		}
+	case "webhook info":
+		var info *telegram.WebhookInfo
+		if info, err = client.GetWebhookInfo(); err == nil {
+			printJSON(info)
+		}
+	case "commands set":
+		if err = SetCommandMenus(client); err == nil {
+			log.Print("[final] command menus set")
+		}
+	case "commands delete":
+		if err = DeleteCommandMenus(client); err == nil {
+			log.Print("[final] command menus deleted")
+		}
+	case "getme":
+		var me *telegram.User
+		if me, err = client.GetMe(); err == nil {
+			printJSON(me)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s failed: %v\n", strings.Join(args, " "), err)
+	}
+}
+
+// printJSON prints a value as indented JSON to the standard output.
+func printJSON(v interface{}) {
+	output, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(output))
+}
+
+// MigrateWarnsHandler is the function that is called when the `--migrate-warns` parameter is invoked.
+// Earlier versions counted warnings globally per user. It moves those counters to the given chat.
+func MigrateWarnsHandler(localCtx *context.InitialContext) {
+	log.Printf("[init] warning migration start %s", defaults.Version)
+
+	ctx, err := Initialization(localCtx)
+	if err != nil {
+		log.Fatalf("initialization failed: %v\n", err)
+	}
+
+	migrated, err := ctx.DB.MigrateLegacyWarns(localCtx.MigrateWarnsChatId)
+	// The old counters are deleted, this list is the only record of what was moved where.
+	for _, warn := range migrated {
+		log.Printf("[info] moved %d warning(s) of user %d to chat %d", warn.Warn, warn.UserID, localCtx.MigrateWarnsChatId)
+	}
+	if err != nil {
+		log.Fatalf("migration failed after %d user(s): %v\n", len(migrated), err)
+	}
+	log.Printf("[final] migrated the warnings of %d user(s) to chat %d", len(migrated), localCtx.MigrateWarnsChatId)
+}
+
+// A webhook update has to be answered before the Lambda function or Telegram times out. Calls wait for retries and
+// the throttle only as long as the timeout leaves room for the calls themselves.
+func webhookMaxWait(Timeout int64) time.Duration {
+	timeout := time.Duration(Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaults.WebhookTimeout
+	}
+	wait := timeout - defaults.WebhookTimeoutMargin
+	if wait < timeout/2 {
+		wait = timeout / 2
+	}
+	return wait
+}
+
+// Checks that the secret token of the webhook is set, before the bot starts to receive updates through the webhook.
+// Without it anyone who finds the webhook URL could send updates in the name of Telegram.
+func requireWebhookSecret(ctx *context.Context) error {
+	if ctx.Cfg.WebhookSecret == "" {
+		return errors.New("WEBHOOKSECRET is required to receive updates through a webhook")
+	}
+	return nil
+}
+
 // Initialization creates and populates the context and sets up connectivity to the testnet.
 func Initialization(initialContext *context.InitialContext) (ctx *context.Context, err error) {
 
 	ctx = context.New()
 
-	if initialContext.LocalExecution {
-		log.Printf("[init] loading config file %s", initialContext.ConfigFile)
-		ctx.Cfg, err = config.GetConfigFromFile(initialContext.ConfigFile)
-		if err != nil {
-			return
-		}
+	ctx.Cfg, err = loadConfig(initialContext)
+	if err != nil {
+		return
+	}
+
+	ctx.Telegram = telegram.NewClient(ctx.Cfg.TelegramAPI, ctx.Cfg.TelegramToken)
+	if !initialContext.Poll {
+		ctx.Telegram.MaxWait = webhookMaxWait(ctx.Cfg.Timeout)
+	}
+
+	// Commands addressed as /command@BotUsername are matched against the username of the bot.
+	if me, getMeError := ctx.Telegram.GetMe(); getMeError != nil {
+		log.Printf("[warning] could not read the bot username, commands addressed to the bot are ignored: %v", getMeError)
 	} else {
-		log.Printf("[init] loading config from environment variables")
-		ctx.Cfg, err = config.GetConfigFromENV()
-		if err != nil {
+		ctx.BotUsername = me.Username
+	}
+
+	if ctx.Cfg.WebhookSecret != "" && !webhookSecretPattern.MatchString(ctx.Cfg.WebhookSecret) {
+		err = errors.New("WEBHOOKSECRET must be 1-256 characters of A-Z, a-z, 0-9, _ and -")
+		return
+	}
+
+	ctx.DB, err = db.New(ctx.Cfg)
+	if err != nil {
+		return
+	}
+
+	if ctx.Cfg.Escalation != "" {
+		if _, err = escalation.Parse(ctx.Cfg.Escalation); err != nil {
 			return
 		}
 	}
 
-	db.Initialize(ctx)
-
 	printCfg := *ctx.Cfg
 	printCfg.TelegramToken = redact(printCfg.TelegramToken)
+	printCfg.WebhookSecret = redact(printCfg.WebhookSecret)
 	log.Printf("[init] config loaded: %+v", printCfg)
 
 	log.Print("[init] initialized context")
@@ -128,6 +297,30 @@ func Initialization(initialContext *context.InitialContext) (ctx *context.Contex
 	return
 }
 
+// handleSignals stops the process gracefully on SIGTERM and SIGINT.
+func handleSignals() {
+	var gracefulStop = make(chan os.Signal, 1)
+	signal.Notify(gracefulStop, syscall.SIGTERM)
+	signal.Notify(gracefulStop, syscall.SIGINT)
+	go func() {
+		sig := <-gracefulStop
+		log.Printf("[final] caught signal: %+v", sig)
+		log.Print("[final] waiting 2 seconds to finish processing")
+		time.Sleep(2 * time.Second)
+		os.Exit(0)
+	}()
+}
+
+// loadConfig reads the configuration from the config file for local execution and from environment variables otherwise.
+func loadConfig(initialContext *context.InitialContext) (*config.Config, error) {
+	if initialContext.LocalExecution {
+		log.Printf("[init] loading config file %s", initialContext.ConfigFile)
+		return config.GetConfigFromFile(initialContext.ConfigFile)
+	}
+	log.Printf("[init] loading config from environment variables")
+	return config.GetConfigFromENV()
+}
+
 // redact changes a string to XXXXXX - used to redact passwords when logging.
 func redact(s string) string {
 	if len(s) < 2 {
@@ -140,11 +333,38 @@ func main() {
 	initialCtx := context.NewInitialContext()
 
 	flag.BoolVar(&initialCtx.LocalExecution, "webserver", false, "run a local web-server instead of as an AWS Lambda function")
+	flag.BoolVar(&initialCtx.Poll, "poll", false, "fetch updates with long polling instead of as an AWS Lambda function or a web-server")
 	flag.StringVar(&initialCtx.ConfigFile, "config", "tmb.conf", "read config from this local file")
 	flag.StringVar(&initialCtx.WebserverIp, "ip", "127.0.0.1", "IP to listen on")
 	flag.UintVar(&initialCtx.WebserverPort, "port", 3000, "Port to listen on")
+	flag.Int64Var(&initialCtx.MigrateWarnsChatId, "migrate-warns", 0, "move the chat-independent warnings of earlier versions to this chat ID and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [webhook set <url> | webhook delete | webhook info | commands set | commands delete | getme]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	//webhook, commands and getme subcommands
+	if flag.NArg() > 0 {
+		initialCtx.LocalExecution = initialCtx.ConfigFile != ""
+		SubcommandHandler(initialCtx, flag.Args())
+		return
+	}
+
+	//--migrate-warns
+	if initialCtx.MigrateWarnsChatId != 0 {
+		initialCtx.LocalExecution = true
+		MigrateWarnsHandler(initialCtx)
+		return
+	}
+
+	//--poll
+	if initialCtx.Poll {
+		initialCtx.LocalExecution = true
+		PollHandler(initialCtx)
+		return
+	}
+
 	//--webserver
 	if initialCtx.LocalExecution {
 		WebserverHandler(initialCtx)
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"github.com/freshautomations/telegram-moderator-bot/context"
+	"github.com/freshautomations/telegram-moderator-bot/db"
+	"github.com/freshautomations/telegram-moderator-bot/defaults"
+	"github.com/freshautomations/telegram-moderator-bot/escalation"
+	"github.com/freshautomations/telegram-moderator-bot/telegram"
+	"log"
+	"strings"
+	"time"
+)
+
+// Unban members from a supergroup and reset their warnings.
+func UnbanMember(ctx *context.Context, ChatId int64, Users []*telegram.User) (result []string, errors []string) {
+	for _, user := range Users {
+		unbanned, failed := ctx.Telegram.UnbanMember(ChatId, []*telegram.User{user})
+		errors = append(errors, failed...)
+		if len(unbanned) == 0 {
+			continue
+		}
+		result = append(result, unbanned...)
+		_ = ctx.DB.ResetUserWarn(ChatId, user.Id)
+	}
+	return
+}
+
+// Ban members from a supergroup until the given time. UntilDate 0 bans them forever.
+// Banned lists the users that were banned, for the Unban buttons of the reply. The bans are recorded with the reason.
+func BanMember(ctx *context.Context, ChatId int64, Users []*telegram.User, UntilDate int64, Reason string, Issuer *telegram.User) (result []string, banned []*telegram.User, errors []string) {
+	for _, user := range Users {
+		list, failed := ctx.Telegram.BanMember(ChatId, []*telegram.User{user}, UntilDate, Reason)
+		errors = append(errors, failed...)
+		if len(list) == 0 {
+			continue
+		}
+		result = append(result, list...)
+		banned = append(banned, user)
+		recordModerationAction(ctx, ChatId, user, db.ActionBan, UntilDate, Reason, Issuer.Id, Issuer.String())
+	}
+	return
+}
+
+// Mute members of a supergroup until the given time. UntilDate 0 mutes them forever. The mutes are recorded with the reason.
+func MuteMember(ctx *context.Context, ChatId int64, Users []*telegram.User, UntilDate int64, Reason string, Issuer *telegram.User) (result []string, errors []string) {
+	for _, user := range Users {
+		list, failed := ctx.Telegram.MuteMember(ChatId, []*telegram.User{user}, UntilDate, Reason)
+		errors = append(errors, failed...)
+		if len(list) == 0 {
+			continue
+		}
+		result = append(result, list...)
+		recordModerationAction(ctx, ChatId, user, db.ActionMute, UntilDate, Reason, Issuer.Id, Issuer.String())
+	}
+	return
+}
+
+// Record a ban or mute with its reason, so it can be looked up with /warns. The action has been taken already,
+// so a failure is only logged.
+func recordModerationAction(ctx *context.Context, ChatId int64, User *telegram.User, Action string, UntilDate int64, Reason string, IssuerId int, IssuerName string) {
+	err := ctx.DB.AddModerationAction(&db.ModerationAction{
+		ChatID:     ChatId,
+		UserID:     User.Id,
+		Action:     Action,
+		IssuerID:   IssuerId,
+		IssuerName: IssuerName,
+		Reason:     Reason,
+		Date:       time.Now().Unix(),
+		UntilDate:  UntilDate,
+	})
+	if err != nil {
+		log.Printf("[error] AddModerationAction: %d, %s, %+v, %+v", ChatId, Action, User, err)
+	}
+}
+
+// Warn members of a supergroup. The Warning holds the issuer, reason and message details, the rest is filled in for each user.
+// The number of active warnings selects the step of the escalation policy that is applied to the user.
+// The errors explain why a step could not be applied.
+func WarnMember(ctx *context.Context, ChatId int64, Users []*telegram.User, Warning *db.Warning) (result []string, errors []string) {
+	settings := GetChatSettings(ctx, ChatId)
+	policy := GetEscalationPolicy(ctx, settings)
+
+	for _, user := range Users {
+		userWarning := *Warning
+		userWarning.ChatID = ChatId
+		userWarning.UserID = user.Id
+		userWarning.Date = time.Now().Unix()
+		warnData, err := ctx.DB.AddWarning(&userWarning)
+		if err != nil {
+			if defaults.Debug {
+				log.Printf("[debug] [error] WarnMember AddWarning error %+v", err.Error())
+			}
+			errors = append(errors, fmt.Sprintf("[%s](tg://user?id=%d): the warning could not be saved", user.String(), user.Id))
+			continue
+		}
+
+		active, legacy := warnData.Active(settings, time.Now())
+		count := len(active) + legacy
+		step := policy.Step(count)
+
+		var untilDate int64
+		if step.Duration > 0 {
+			untilDate = time.Now().Add(step.Duration).Unix()
+		}
+
+		var failed []string
+		switch step.Action {
+		case escalation.Mute:
+			_, failed = ctx.Telegram.MuteMember(ChatId, []*telegram.User{user}, untilDate, userWarning.Reason)
+			if len(failed) == 0 {
+				recordModerationAction(ctx, ChatId, user, db.ActionMute, untilDate, userWarning.Reason, userWarning.IssuerID, userWarning.IssuerName)
+			}
+		case escalation.Ban:
+			_, failed = ctx.Telegram.BanMember(ChatId, []*telegram.User{user}, untilDate, userWarning.Reason)
+			if len(failed) == 0 {
+				recordModerationAction(ctx, ChatId, user, db.ActionBan, untilDate, userWarning.Reason, userWarning.IssuerID, userWarning.IssuerName)
+			}
+		}
+
+		outcome := step.String()
+		if len(failed) > 0 {
+			outcome = fmt.Sprintf("could not be %s", outcome)
+			errors = append(errors, failed...)
+		}
+
+		var expiries []string
+		for _, warning := range active {
+			expiries = append(expiries, formatExpiry(warning.Expires))
+		}
+		for i := 0; i < legacy; i++ {
+			expiries = append(expiries, formatExpiry(0))
+		}
+		result = append(result, fmt.Sprintf("[%s](tg://user?id=%d) - warning %d: %s (expiring: %s)", user.String(), user.Id, count, outcome, strings.Join(expiries, "; ")))
+	}
+	return
+}
+
+// Get the escalation policy of a supergroup. Falls back to the configured default and then to the built-in default.
+func GetEscalationPolicy(ctx *context.Context, Settings *db.ChatSettings) escalation.Policy {
+	for _, s := range []string{Settings.Escalation, ctx.Cfg.Escalation} {
+		if s == "" {
+			continue
+		}
+		policy, err := escalation.Parse(s)
+		if err != nil {
+			log.Printf("[error] GetEscalationPolicy: %s, %+v", s, err)
+			continue
+		}
+		return policy
+	}
+	policy, _ := escalation.Parse(defaults.Escalation)
+	return policy
+}
+
+// List the warning history of a member of a supergroup, and the bans and mutes of the member with their reasons.
+func ListWarnings(ctx *context.Context, ChatId int64, User *telegram.User) (result []string, actions []string, err error) {
+	warnData, err := ctx.DB.GetWarnData(ChatId, User.Id)
+	if err != nil {
+		log.Printf("[error] ListWarnings GetWarnData: %+v, %+v", User, err)
+		return
+	}
+
+	expires := make(map[*db.Warning]int64)
+	active, _ := warnData.Active(GetChatSettings(ctx, ChatId), time.Now())
+	for _, warning := range active {
+		expires[warning.Warning] = warning.Expires
+	}
+
+	for i, warning := range warnData.Warnings {
+		line := fmt.Sprintf("%d. %s", i+1, telegram.FormatDate(warning.Date))
+		if warning.IssuerName != "" {
+			line = fmt.Sprintf("%s by [%s](tg://user?id=%d)", line, telegram.EscapeMarkdown(warning.IssuerName), warning.IssuerID)
+		}
+		if warning.Reason != "" {
+			line = fmt.Sprintf("%s: %s", line, telegram.EscapeMarkdown(warning.Reason))
+		}
+		if expiry, ok := expires[warning]; ok {
+			line = fmt.Sprintf("%s (expiring: %s)", line, formatExpiry(expiry))
+		} else {
+			line = fmt.Sprintf("%s (inactive)", line)
+		}
+		result = append(result, line)
+	}
+
+	for i, action := range warnData.Actions {
+		line := fmt.Sprintf("%d. %s %s", i+1, telegram.FormatDate(action.Date), actionText(action.Action))
+		if action.UntilDate > 0 {
+			line = fmt.Sprintf("%s until %s", line, telegram.FormatDate(action.UntilDate))
+		}
+		if action.IssuerName != "" {
+			line = fmt.Sprintf("%s by [%s](tg://user?id=%d)", line, telegram.EscapeMarkdown(action.IssuerName), action.IssuerID)
+		}
+		if action.Reason != "" {
+			line = fmt.Sprintf("%s: %s", line, telegram.EscapeMarkdown(action.Reason))
+		}
+		actions = append(actions, line)
+	}
+
+	return
+}
+
+// Describe a recorded moderation action for messages.
+func actionText(Action string) string {
+	switch Action {
+	case db.ActionBan:
+		return "banned"
+	case db.ActionMute:
+		return "muted"
+	}
+	return Action
+}
+
+// List the current and past usernames and names of a user. Past ones are listed newest first.
+// The list is empty if the bot has not seen the user.
+func ListUserHistory(ctx *context.Context, User *telegram.User) (result []string, err error) {
+	history, err := ctx.DB.GetUserHistory(User.Id)
+	if err != nil {
+		log.Printf("[error] ListUserHistory GetUserHistory: %+v, %+v", User, err)
+		return
+	}
+	if history == nil {
+		return
+	}
+
+	username := "none"
+	if history.Username != "" {
+		username = "@" + telegram.EscapeMarkdown(history.Username)
+	}
+	result = append(result,
+		fmt.Sprintf("Username: %s", username),
+		fmt.Sprintf("Name: %s", telegram.EscapeMarkdown(history.Name)),
+		fmt.Sprintf("First seen: %s", telegram.FormatDate(history.FirstSeen)))
+
+	if len(history.Usernames) > 0 {
+		var usernames []string
+		for i := len(history.Usernames) - 1; i >= 0; i-- {
+			change := history.Usernames[i]
+			usernames = append(usernames, fmt.Sprintf("@%s (until %s)", telegram.EscapeMarkdown(change.Value), telegram.FormatDate(change.Until)))
+		}
+		result = append(result, fmt.Sprintf("Past usernames: %s", strings.Join(usernames, ", ")))
+	}
+	if len(history.Names) > 0 {
+		var names []string
+		for i := len(history.Names) - 1; i >= 0; i-- {
+			change := history.Names[i]
+			names = append(names, fmt.Sprintf("%s (until %s)", telegram.EscapeMarkdown(change.Value), telegram.FormatDate(change.Until)))
+		}
+		result = append(result, fmt.Sprintf("Past names: %s", strings.Join(names, ", ")))
+	}
+
+	return
+}
+
+// Get the settings of a supergroup. Falls back to the default settings if they can not be read.
+func GetChatSettings(ctx *context.Context, ChatId int64) *db.ChatSettings {
+	settings, err := ctx.DB.GetChatSettings(ChatId)
+	if err != nil {
+		log.Printf("[error] GetChatSettings: %d, %+v", ChatId, err)
+		return &db.ChatSettings{ChatID: ChatId}
+	}
+	return settings
+}
+
+// Format the expiry time of a warning for messages.
+func formatExpiry(Expires int64) string {
+	if Expires == 0 {
+		return "never"
+	}
+	return telegram.FormatDate(Expires)
+}
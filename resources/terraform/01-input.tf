@@ -20,3 +20,8 @@ variable "TELEGRAM_TOKEN" {
   type = "string"
   description = "Telegram Token received from @BotFather"
 }
+
+variable "WEBHOOK_SECRET" {
+  type = "string"
+  description = "Secret token that Telegram sends with the webhook requests"
+}
@@ -45,7 +45,12 @@ resource "aws_iam_policy" "tmb" {
       "Action": "dynamodb:*",
       "Resource": [
         "arn:aws:dynamodb:us-east-1:${data.aws_caller_identity.current.account_id}:table/tmb-${var.ENVIRONMENT}-users",
-        "arn:aws:dynamodb:us-east-1:${data.aws_caller_identity.current.account_id}:table/tmb-${var.ENVIRONMENT}-warns"
+        "arn:aws:dynamodb:us-east-1:${data.aws_caller_identity.current.account_id}:table/tmb-${var.ENVIRONMENT}-userids",
+        "arn:aws:dynamodb:us-east-1:${data.aws_caller_identity.current.account_id}:table/tmb-${var.ENVIRONMENT}-warns",
+        "arn:aws:dynamodb:us-east-1:${data.aws_caller_identity.current.account_id}:table/tmb-${var.ENVIRONMENT}-chatwarns",
+        "arn:aws:dynamodb:us-east-1:${data.aws_caller_identity.current.account_id}:table/tmb-${var.ENVIRONMENT}-chats",
+        "arn:aws:dynamodb:us-east-1:${data.aws_caller_identity.current.account_id}:table/tmb-${var.ENVIRONMENT}-pending",
+        "arn:aws:dynamodb:us-east-1:${data.aws_caller_identity.current.account_id}:table/tmb-${var.ENVIRONMENT}-updates"
       ],
       "Effect": "Allow"
     },
@@ -158,6 +163,88 @@ resource aws_dynamodb_table tmb-warns {
   }
 }
 
+resource aws_dynamodb_table tmb-userids {
+  name           = "tmb-${var.ENVIRONMENT}-userids"
+  hash_key       = "id"
+  read_capacity  = 5
+  write_capacity = 5
+
+  attribute {
+    name = "id"
+    type = "N"
+  }
+}
+
+resource aws_dynamodb_table tmb-chatwarns {
+  name           = "tmb-${var.ENVIRONMENT}-chatwarns"
+  hash_key       = "chat"
+  range_key      = "id"
+  read_capacity  = 5
+  write_capacity = 5
+
+  attribute {
+    name = "chat"
+    type = "N"
+  }
+
+  attribute {
+    name = "id"
+    type = "N"
+  }
+}
+
+resource aws_dynamodb_table tmb-chats {
+  name           = "tmb-${var.ENVIRONMENT}-chats"
+  hash_key       = "chat"
+  read_capacity  = 5
+  write_capacity = 5
+
+  attribute {
+    name = "chat"
+    type = "N"
+  }
+}
+
+resource aws_dynamodb_table tmb-pending {
+  name           = "tmb-${var.ENVIRONMENT}-pending"
+  hash_key       = "chat"
+  range_key      = "id"
+  read_capacity  = 5
+  write_capacity = 5
+
+  attribute {
+    name = "chat"
+    type = "N"
+  }
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires"
+    enabled        = true
+  }
+}
+
+resource aws_dynamodb_table tmb-updates {
+  name           = "tmb-${var.ENVIRONMENT}-updates"
+  hash_key       = "id"
+  read_capacity  = 5
+  write_capacity = 5
+
+  attribute {
+    name = "id"
+    type = "N"
+  }
+
+  ttl {
+    attribute_name = "expires"
+    enabled        = true
+  }
+}
+
 resource aws_lambda_function tmb {
   function_name = "tmb-${var.ENVIRONMENT}"
   filename      = "../../build/tmb.zip"
@@ -167,7 +254,7 @@ resource aws_lambda_function tmb {
   runtime = "go1.x"
 
   role    = "${aws_iam_role.tmb.arn}"
-  timeout = 5
+  timeout = "${var.LAMBDA_TIMEOUT}"
 
   source_code_hash = "${base64sha256(file("../../build/tmb.zip"))}"
   publish          = true
@@ -178,6 +265,7 @@ resource aws_lambda_function tmb {
       "TIMEOUT"       = "${var.LAMBDA_TIMEOUT}"
       "AWSREGION"     = "us-east-1"
       "TELEGRAMTOKEN" = "${var.TELEGRAM_TOKEN}"
+      "WEBHOOKSECRET" = "${var.WEBHOOK_SECRET}"
     }
   }
 
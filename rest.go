@@ -1,36 +1,24 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/freshautomations/telegram-moderator-bot/context"
 	"github.com/freshautomations/telegram-moderator-bot/db"
 	"github.com/freshautomations/telegram-moderator-bot/defaults"
+	"github.com/freshautomations/telegram-moderator-bot/duration"
 	"github.com/freshautomations/telegram-moderator-bot/telegram"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
-// Available administrator commands help text. X will be replaced with backtick.
-const textHelpAdminCommands = `
-X/promoteX _@username_ - Promote a user to moderator.
-X/demoteX _@username_ - Demote a moderator to user.`
-
-// Available moderator commands help text. X will be replaced with backtick.
-const textHelpModeratorCommands = `
-X/banX _@username_ - Kick and ban a user.
-X/unbanX _@username_ - Unban a user.
-X/warnX _@username_ - Warn a user.
-X/listX - List moderators.`
-
-// Composed help text.
-const textHelpMessage = `Hi %s!
-You are a%s.
-
-Available commands:%s%s`
-
 // Template for list-like messages.
 const textListMessage = `%s:
 %s.`
@@ -47,6 +35,8 @@ const (
 	creator
 	kicked
 	left
+	restricted
+	everyone
 )
 
 // Structure to hold parsed incoming text.
@@ -54,16 +44,24 @@ type CommandData struct {
 	Command     string
 	Users       []*telegram.User
 	UserStrings []string
+	UserIds     []int
+	Reason      string
 }
 
-// Filters incoming messages and updates internal database with user IDs. Filters out bots.
+// Filters incoming messages and updates internal database with user IDs: the sender, members who joined or left
+// and members whose status changed. Filters out bots.
 func PreprocessMessage(ctx *context.Context, incoming *telegram.Update) (message *telegram.Message) {
 	var from *telegram.User = nil
+	var members []*telegram.User
 
 	switch {
 	case incoming.Message != nil:
 		message = incoming.Message
 		from = message.From
+		members = append(members, message.NewChatMembers...)
+		if message.LeftChatMember != nil {
+			members = append(members, message.LeftChatMember)
+		}
 	case incoming.EditedMessage != nil:
 		message = incoming.EditedMessage
 		from = message.From
@@ -73,7 +71,7 @@ func PreprocessMessage(ctx *context.Context, incoming *telegram.Update) (message
 		from = incoming.EditedChannelPost.From
 	case incoming.InlineQuery != nil:
 		from = incoming.InlineQuery.From
-	case incoming.ChosenInlineResult.From != nil:
+	case incoming.ChosenInlineResult != nil:
 		from = incoming.ChosenInlineResult.From
 	case incoming.CallbackQuery != nil:
 		from = incoming.CallbackQuery.From
@@ -81,80 +79,289 @@ func PreprocessMessage(ctx *context.Context, incoming *telegram.Update) (message
 		from = incoming.PreCheckoutQuery.From
 	case incoming.ShippingQuery != nil:
 		from = incoming.ShippingQuery.From
+	case incoming.ChatMember != nil:
+		from = incoming.ChatMember.From
+		if incoming.ChatMember.NewChatMember != nil {
+			members = append(members, incoming.ChatMember.NewChatMember.User)
+		}
+	case incoming.MyChatMember != nil:
+		from = incoming.MyChatMember.From
+		if change := incoming.MyChatMember; change.Chat != nil && change.NewChatMember != nil {
+			log.Printf("[info] The bot is %s in %d (%s), changed by %s.", change.NewChatMember.Status, change.Chat.Id, change.Chat.Title, from)
+		}
 	default:
 		return
 	}
 
-	if from.IsBot {
+	// Messages of bots are not processed, but the members they changed are still recorded.
+	if from == nil || from.IsBot {
+		message = nil
+	} else {
+		members = append(members, from)
+	}
+
+	for _, member := range members {
+		updateUserData(ctx, member)
+	}
+
+	return
+}
+
+// Saves the details of a user, so it can be found by username and its name changes are recorded. Bots are skipped.
+func updateUserData(ctx *context.Context, user *telegram.User) {
+	if user == nil || user.IsBot {
 		return
 	}
 
-	name := from.FirstName
-	if from.LastName != "" {
-		name = name + " " + from.LastName
+	name := user.FirstName
+	if user.LastName != "" {
+		name = name + " " + user.LastName
 	}
 
-	err := db.UpdateUserData(ctx, &db.UserData{from.Username, from.Id, name})
+	err := ctx.DB.UpdateUserData(&db.UserData{Username: user.Username, UserID: user.Id, Name: name})
 	if err != nil {
 		//Todo: handle DynamoDB capacity limitations
 		log.Printf("[tempdebug] error updating user in DB: %+v", err.Error())
 	}
-
-	return
 }
 
-// Parse the incoming message for bot command and a list of users.
-func ParseInput(m *telegram.Message) *CommandData {
+// Parse the incoming message for bot command and a list of users. Users are mentions or numeric user IDs.
+// If there are none, the command targets the sender of the replied-to message.
+// Captions of media messages are parsed like text. Commands addressed to other bots (/command@OtherBot) are ignored,
+// the suffix of commands addressed to this bot is cut off.
+func ParseInput(m *telegram.Message, BotUsername string) *CommandData {
 	output := &CommandData{}
 
-	if len(m.Entities) < 1 {
-		return nil
+	text, entities := m.Text, m.Entities
+	if text == "" {
+		text, entities = m.Caption, m.CaptionEntities
 	}
 
-	if m.Text[0] != '/' {
+	if len(text) < 1 || text[0] != '/' {
 		return nil
 	}
 
-	if m.Entities[0].Type != "bot_command" {
+	var commandEnd int
+	found := false
+	for _, entity := range entities {
+		if entity == nil || entity.Type != "bot_command" {
+			continue
+		}
+		start, end, ok := telegram.EntityBounds(text, entity)
+		if ok && start == 0 {
+			commandEnd, found = end, true
+			break
+		}
+	}
+	if !found {
 		return nil
-	} else {
-		output.Command = m.Text[m.Entities[0].Offset : m.Entities[0].Offset+m.Entities[0].Length]
 	}
-	for _, entity := range m.Entities {
+	output.Command = text[:commandEnd]
+
+	if at := strings.IndexByte(output.Command, '@'); at >= 0 {
+		if BotUsername == "" || !strings.EqualFold(output.Command[at+1:], BotUsername) {
+			return nil
+		}
+		output.Command = output.Command[:at]
+	}
+
+	reasonStart := commandEnd
+	var covered [][2]int
+	for _, entity := range entities {
+		if entity == nil || (entity.Type != "text_mention" && entity.Type != "mention") {
+			continue
+		}
+		start, end, ok := telegram.EntityBounds(text, entity)
+		if !ok || start < commandEnd {
+			continue
+		}
 		if entity.Type == "text_mention" {
+			if entity.User == nil {
+				continue
+			}
 			output.Users = append(output.Users, entity.User)
 		} else {
-			if entity.Type == "mention" {
-				//Cut off the "@" from the front of the username.
-				output.UserStrings = append(output.UserStrings, m.Text[entity.Offset+1:entity.Offset+entity.Length])
+			//Cut off the "@" from the front of the username.
+			if end-start < 2 || text[start] != '@' {
+				continue
 			}
+			output.UserStrings = append(output.UserStrings, text[start+1:end])
+		}
+		covered = append(covered, [2]int{start, end})
+		if end > reasonStart {
+			reasonStart = end
+		}
+	}
+
+	firstMention := len(text)
+	for _, bounds := range covered {
+		if bounds[0] < firstMention {
+			firstMention = bounds[0]
 		}
 	}
 
+	//Numeric user IDs are accepted only directly after the command, before any mention or other word, so a number
+	//in the reason, as in "/warn @alice 3 times spamming", is never taken for a user. In a reply, the command targets
+	//the sender of the replied-to message, so numbers are always part of the reason there.
+	idsEnd := commandEnd
+	if m.ReplyToMessage == nil || m.ReplyToMessage.From == nil {
+		for {
+			field, remainder := cutField(text[idsEnd:])
+			userId, ok := parseUserId(field)
+			if !ok || len(text)-len(remainder) > firstMention {
+				break
+			}
+			output.UserIds = append(output.UserIds, userId)
+			idsEnd = len(text) - len(remainder)
+		}
+	}
+	if idsEnd > reasonStart {
+		reasonStart = idsEnd
+	}
+
+	//Words between the mentions are kept for the reason.
+	between := []byte(text[:reasonStart])
+	for _, bounds := range covered {
+		for i := bounds[0]; i < bounds[1]; i++ {
+			between[i] = ' '
+		}
+	}
+	words := strings.Fields(string(between[idsEnd:]))
+	rest := text[reasonStart:]
+
+	//Without mentions, the command targets the sender of the message it replies to.
+	if len(output.Users) < 1 && len(output.UserStrings) < 1 && len(output.UserIds) < 1 && m.ReplyToMessage != nil && m.ReplyToMessage.From != nil {
+		output.Users = append(output.Users, m.ReplyToMessage.From)
+	}
+
+	//Everything that is not a user is the reason. Commands that take a duration cut it off the front later.
+	output.Reason = strings.TrimSpace(strings.Join(append(words, strings.TrimSpace(rest)), " "))
+
 	return output
 }
 
+// Parses a numeric Telegram user ID.
+func parseUserId(field string) (int, bool) {
+	if field == "" || strings.Trim(field, "0123456789") != "" {
+		return 0, false
+	}
+	userId, err := strconv.Atoi(field)
+	if err != nil || userId < 1 {
+		return 0, false
+	}
+	return userId, true
+}
+
+// Splits the first whitespace-separated field from the rest of the text.
+func cutField(text string) (field, rest string) {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	end := strings.IndexFunc(text, unicode.IsSpace)
+	if end < 0 {
+		return text, ""
+	}
+	return text[:end], text[end:]
+}
+
+// Composes a list-like message and adds the reason of the command, if there is one.
+func listMessage(title string, list []string, reason string) string {
+	text := fmt.Sprintf(textListMessage, title, strings.Join(list, textNewlineComma))
+	if reason != "" {
+		text = fmt.Sprintf("%s\nReason: %s", text, telegram.EscapeMarkdown(reason))
+	}
+	return text
+}
+
+// Takes the optional duration from the front of the command's reason. Returns 0 if there is none.
+func parseDuration(command *CommandData) time.Duration {
+	field, rest := cutField(command.Reason)
+	d, err := duration.Parse(field)
+	if err != nil {
+		return 0
+	}
+	command.Reason = strings.TrimSpace(rest)
+	return d
+}
+
+// Flag of the commands that also delete the replied-to message.
+const deleteFlag = "-d"
+
+// Takes the optional delete flag from the front of the command's reason. Returns false if there is none.
+func parseDeleteFlag(command *CommandData) bool {
+	field, rest := cutField(command.Reason)
+	if field != deleteFlag {
+		return false
+	}
+	command.Reason = strings.TrimSpace(rest)
+	return true
+}
+
+// Checks the -d flag of the command. Returns the ID of the replied-to message to delete, or the explanation why there is none.
+func parseDeleteTarget(command *CommandData, message *telegram.Message) (int64, []string) {
+	if !parseDeleteFlag(command) {
+		return 0, nil
+	}
+	if message.ReplyToMessage == nil {
+		return 0, []string{"there is no replied-to message to delete"}
+	}
+	return message.ReplyToMessage.MessageId, nil
+}
+
+// Deletes the replied-to message of a command that was carried out. MessageId 0 deletes nothing.
+// Returns the explanation of the failure, if there was one.
+func deleteTargetMessage(ctx *context.Context, ChatId int64, MessageId int64) []string {
+	if MessageId == 0 {
+		return nil
+	}
+	if err := ctx.Telegram.DeleteMessage(ChatId, MessageId); err != nil {
+		return []string{fmt.Sprintf("the replied-to message could not be deleted: %s", telegram.Explain(err))}
+	}
+	return nil
+}
+
+// Checks that Telegram accepts the duration of a temporary ban or mute.
+func checkRestrictDuration(d time.Duration) error {
+	if d < defaults.MinRestrictDuration || d > defaults.MaxRestrictDuration {
+		return fmt.Errorf("The duration must be between %s and %s.", duration.Format(defaults.MinRestrictDuration), duration.Format(defaults.MaxRestrictDuration))
+	}
+	return nil
+}
+
+// Explanations of why a user was skipped, by MembersType.
+var membersTypeMismatch = map[int]string{
+	regular:         "not a regular member of the chat",
+	moderators:      "not a moderator",
+	admininstrators: "not an administrator",
+	creator:         "not the creator of the chat",
+	kicked:          "not banned",
+	left:            "not a former member of the chat",
+	restricted:      "not muted",
+}
+
 // Checks the list of members and compiles a User array out of valid users.
-func CheckMembers(ctx *context.Context, ChatId int64, command *CommandData, MembersType int) []*telegram.User {
+// The errors explain why the rest of the users were skipped.
+func CheckMembers(ctx *context.Context, ChatId int64, command *CommandData, MembersType int) (result []*telegram.User, errors []string) {
 	var ids []int
-	var result []*telegram.User
 
 	for _, user := range command.Users {
 		ids = append(ids, user.Id)
 	}
 
+	ids = append(ids, command.UserIds...)
+
 	for _, user := range command.UserStrings {
-		dbUserData, err := db.GetUserData(ctx, user)
+		dbUserData, err := ctx.DB.GetUserData(user)
 		if err != nil {
 			if defaults.Debug {
 				log.Printf("[debug] (CheckMembers) Could not get user data from database for user %s, %+v", user, err.Error())
 			}
+			errors = append(errors, fmt.Sprintf("@%s: could not look up the user", telegram.EscapeMarkdown(user)))
 			continue
 		}
 		if dbUserData == nil {
 			if defaults.Debug {
 				log.Printf("[debug] (CheckMembers) User not found in database: %s", user)
 			}
+			errors = append(errors, fmt.Sprintf("@%s: the bot has not seen this user yet, use their numeric ID or reply to their message", telegram.EscapeMarkdown(user)))
 			continue
 		}
 
@@ -162,15 +369,17 @@ func CheckMembers(ctx *context.Context, ChatId int64, command *CommandData, Memb
 	}
 
 	for _, userId := range ids {
-		userData, err := telegram.GetChatMember(ctx, ChatId, userId)
+		userData, err := ctx.Telegram.GetChatMember(ChatId, userId)
 		if err != nil {
 			if defaults.Debug {
 				log.Printf("[debug] (CheckMembers) Could not get user verification data from Telegram for user ID %d, %+v", userId, err.Error())
 			}
+			errors = append(errors, fmt.Sprintf("[%d](tg://user?id=%d): %s", userId, userId, telegram.Explain(err)))
 			continue
 		}
 
 		if userData.User.IsBot {
+			errors = append(errors, fmt.Sprintf("[%s](tg://user?id=%d): bots can not be moderated", userData.User.String(), userData.User.Id))
 			continue
 		}
 
@@ -178,53 +387,106 @@ func CheckMembers(ctx *context.Context, ChatId int64, command *CommandData, Memb
 			log.Printf("[debug] CheckMembers ChatMember %+v.", userData)
 		}
 
-		if MembersType == regular {
-			if userData.Status != "member" {
-				continue
+		if !isMembersType(userData, MembersType) {
+			reason := membersTypeMismatch[MembersType]
+			if MembersType == regular && (userData.Status == "administrator" || userData.Status == "creator") {
+				reason = telegram.ErrUserIsAdministrator.Error()
 			}
+			errors = append(errors, fmt.Sprintf("[%s](tg://user?id=%d): %s", userData.User.String(), userData.User.Id, reason))
+			continue
 		}
 
-		if MembersType == creator {
-			if userData.Status != "creator" {
-				continue
-			}
+		if defaults.Debug {
+			log.Printf("[debug] CheckMembers Keeping ChatMember %+v.", userData)
 		}
 
-		if MembersType == kicked {
-			if userData.Status != "kicked" {
-				continue
-			}
-		}
+		result = append(result, userData.User)
+	}
+	return
+}
 
-		if MembersType == left {
-			if userData.Status != "left" {
-				continue
-			}
-		}
+// Checks if a member of a supergroup belongs to the given MembersType.
+func isMembersType(userData *telegram.ChatMember, MembersType int) bool {
+	switch MembersType {
+	case regular:
+		return userData.Status == "member" || userData.Status == "restricted"
+	case restricted:
+		return userData.Status == "restricted"
+	case creator:
+		return userData.Status == "creator"
+	case kicked:
+		return userData.Status == "kicked"
+	case left:
+		return userData.Status == "left"
+	case moderators:
+		return userData.Status == "administrator" && !userData.CanPromoteMembers
+	case admininstrators:
+		return (userData.Status == "administrator" && userData.CanPromoteMembers) || userData.Status == "creator"
+	}
+	return true
+}
 
-		if MembersType == moderators {
-			if userData.Status != "administrator" || userData.CanPromoteMembers {
-				continue
-			}
-		}
+// Replies with the explanation of each failure, if there were any.
+func replyErrors(ctx *context.Context, ChatId int64, MessageId int64, errors []string) {
+	if len(errors) > 0 {
+		ctx.Telegram.ReplyMessage(ChatId, MessageId, fmt.Sprintf(textListMessage, "Errors", strings.Join(errors, textNewlineComma)))
+	}
+}
 
-		if MembersType == admininstrators {
-			if (userData.Status != "administrator" || !userData.CanPromoteMembers) && userData.Status != "creator" {
-				continue
-			}
-		}
+// Bans the users and replies with the list of banned users. UntilDate 0 bans them forever.
+// Returns whether any user was banned and the explanations of the failed bans.
+func banUsers(ctx *context.Context, ChatId int64, MessageId int64, Users []*telegram.User, UntilDate int64, Reason string, Issuer *telegram.User) (bool, []string) {
+	list, banned, errors := BanMember(ctx, ChatId, Users, UntilDate, Reason, Issuer)
+	if len(list) < 1 {
+		ctx.Telegram.ReplyMessage(ChatId, MessageId, "No users were banned.")
+		return false, errors
+	}
 
-		if defaults.Debug {
-			log.Printf("[debug] CheckMembers Keeping ChatMember %+v.", userData)
-		}
+	title := "Banned user(s)"
+	if UntilDate > 0 {
+		title = fmt.Sprintf("Banned user(s) until %s", telegram.FormatDate(UntilDate))
+	}
+	ctx.Telegram.ReplyMessageWithKeyboard(ChatId, MessageId, listMessage(title, list, Reason), unbanKeyboard(ctx, ChatId, banned))
+	return true, errors
+}
 
-		result = append(result, userData.User)
+// Mutes the users and replies with the list of muted users. UntilDate 0 mutes them forever.
+// Returns the explanations of the failed mutes.
+func muteUsers(ctx *context.Context, ChatId int64, MessageId int64, Users []*telegram.User, UntilDate int64, Reason string, Issuer *telegram.User) []string {
+	list, errors := MuteMember(ctx, ChatId, Users, UntilDate, Reason, Issuer)
+	if len(list) < 1 {
+		ctx.Telegram.ReplyMessage(ChatId, MessageId, "No users were muted.")
+		return errors
+	}
+
+	title := "Muted user(s)"
+	if UntilDate > 0 {
+		title = fmt.Sprintf("Muted user(s) until %s", telegram.FormatDate(UntilDate))
 	}
-	return result
+	ctx.Telegram.ReplyMessage(ChatId, MessageId, listMessage(title, list, Reason))
+	return errors
+}
+
+// Warns the users and replies with the list of warned users.
+// Returns whether any user was warned and the explanations of the failed warnings.
+func warnUsers(ctx *context.Context, ChatId int64, MessageId int64, Users []*telegram.User, Warning *db.Warning) (bool, []string) {
+	list, errors := WarnMember(ctx, ChatId, Users, Warning)
+	if len(list) < 1 {
+		ctx.Telegram.ReplyMessage(ChatId, MessageId, "No users were warned.")
+		return false, errors
+	}
+	ctx.Telegram.ReplyMessage(ChatId, MessageId, listMessage("Warned user(s)", list, Warning.Reason))
+	return true, errors
 }
 
 // MainHandler handles the requests coming to `/`.
+// Requests without the configured webhook secret token are rejected.
 func MainHandler(ctx *context.Context, w http.ResponseWriter, r *http.Request) (status int, err error) {
+	if !checkWebhookSecret(ctx, r) {
+		log.Printf("[warning] MainHandler rejected a request without a valid secret token from %s", r.RemoteAddr)
+		return http.StatusUnauthorized, errors.New("invalid secret token")
+	}
+
 	status = http.StatusOK
 	w.WriteHeader(status)
 
@@ -242,8 +504,38 @@ func MainHandler(ctx *context.Context, w http.ResponseWriter, r *http.Request) (
 		return
 	}
 
+	// Telegram sends the update again if the answer was too slow. Handle it only once.
+	added, addUpdateError := ctx.DB.AddUpdate(incoming.UpdateId, time.Now().Add(defaults.UpdateRetention).Unix())
+	if addUpdateError != nil {
+		log.Printf("[error] AddUpdate: %d, %+v", incoming.UpdateId, addUpdateError)
+	} else if !added {
+		log.Printf("[info] Skipping update %d, it was handled already.", incoming.UpdateId)
+		return
+	}
+
+	err = ProcessUpdate(ctx, incoming)
+	return
+}
+
+// Checks the secret token that Telegram sends with the webhook requests. Every request fails if no secret is configured.
+func checkWebhookSecret(ctx *context.Context, r *http.Request) bool {
+	if ctx.Cfg.WebhookSecret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(defaults.WebhookSecretHeader)), []byte(ctx.Cfg.WebhookSecret)) == 1
+}
+
+// Types of updates that ProcessUpdate handles. Telegram is asked to send only these.
+var handledUpdates = []string{"message", "callback_query", "chat_member", "my_chat_member"}
+
+// ProcessUpdate handles an update, regardless of whether it came through the webhook or from polling.
+func ProcessUpdate(ctx *context.Context, incoming *telegram.Update) (err error) {
 	message := PreprocessMessage(ctx, incoming)
 
+	if incoming.CallbackQuery != nil {
+		return ProcessCallbackQuery(ctx, incoming.CallbackQuery)
+	}
+
 	if message == nil {
 		return
 	}
@@ -252,7 +544,7 @@ func MainHandler(ctx *context.Context, w http.ResponseWriter, r *http.Request) (
 		return
 	}
 
-	command := ParseInput(message)
+	command := ParseInput(message, ctx.BotUsername)
 	if command == nil {
 		return
 	}
@@ -261,104 +553,38 @@ func MainHandler(ctx *context.Context, w http.ResponseWriter, r *http.Request) (
 	messageId := message.MessageId
 
 	if defaults.Debug {
-		log.Printf("[debug] Command received %s from %s. Mentions: %s, Text_Mentions: %+v.", command.Command, message.From, strings.Join(command.UserStrings, ";"), command.Users)
+		log.Printf("[debug] Command received %s from %s. Mentions: %s, Text_Mentions: %+v, User IDs: %v.", command.Command, message.From, strings.Join(command.UserStrings, ";"), command.Users, command.UserIds)
 		log.Printf("[debug] Chat ID: %d, Message ID: %d, User ID: %d", chatId, messageId, message.From.Id)
 	}
 
-	isAdmin, isMod, getPrivilegesError := telegram.GetPrivileges(ctx, chatId, message.From.Id)
-	if getPrivilegesError != nil {
-		telegram.ReplyMessage(ctx, chatId, messageId, "Could not check user privileges.")
-		return status, getPrivilegesError
-	}
-
-	if !isMod {
+	handler := findCommand(command.Command)
+	if handler == nil {
 		return
 	}
 
-	// Commands for moderators
-	switch command.Command {
-	case "/help":
-		adminCommands := ""
-		privilegeSnippet := " *moderator*"
-		if isAdmin {
-			privilegeSnippet = "n *administrator*"
-			adminCommands = textHelpAdminCommands
-		}
+	isAdmin, isMod, getPrivilegesError := ctx.Telegram.GetPrivileges(chatId, message.From.Id)
+	if getPrivilegesError != nil {
+		ctx.Telegram.ReplyMessage(chatId, messageId, "Could not check user privileges.")
+		return getPrivilegesError
+	}
 
-		text := fmt.Sprintf(textHelpMessage,
-			message.From.FirstName,
-			privilegeSnippet,
-			strings.Replace(textHelpModeratorCommands, "X", "`", -1),
-			strings.Replace(adminCommands, "X", "`", -1))
-		telegram.ReplyMessage(ctx, chatId, messageId, text)
-		return
-	case "/warn":
-		warned, banned := telegram.WarnMember(ctx, chatId, CheckMembers(ctx, chatId, command, regular))
-		if len(warned) >= 1 {
-			telegram.ReplyMessage(ctx, chatId, messageId, fmt.Sprintf(textListMessage, "Warned user(s)", strings.Join(warned, textNewlineComma)))
-		}
-		if len(banned) >= 1 {
-			telegram.ReplyMessage(ctx, chatId, messageId, fmt.Sprintf(textListMessage, "Banned user(s)", strings.Join(banned, textNewlineComma)))
-		}
-		if len(warned) < 1 && len(banned) < 1 {
-			telegram.ReplyMessage(ctx, chatId, messageId, "No users were warned.")
-		}
-		return
-	case "/ban":
-		list := telegram.BanMember(ctx, chatId, CheckMembers(ctx, chatId, command, regular))
-		if len(list) < 1 {
-			telegram.ReplyMessage(ctx, chatId, messageId, "No users were banned.")
-		} else {
-			telegram.ReplyMessage(ctx, chatId, messageId, fmt.Sprintf(textListMessage, "Banned user(s)", strings.Join(list, textNewlineComma)))
-		}
-		return
-	case "/unban":
-		list := telegram.UnbanMember(ctx, chatId, CheckMembers(ctx, chatId, command, kicked))
-		if len(list) < 1 {
-			telegram.ReplyMessage(ctx, chatId, messageId, "No users were unbanned.")
-		} else {
-			telegram.ReplyMessage(ctx, chatId, messageId, fmt.Sprintf(textListMessage, "Unbanned user(s)", strings.Join(list, textNewlineComma)))
-		}
-		return
-	case "/list":
-		list := telegram.ListModerators(ctx, chatId)
-		if len(list) < 1 {
-			telegram.ReplyMessage(ctx, chatId, messageId, "No moderators found.")
-		} else {
-			telegram.ReplyMessage(ctx, chatId, messageId, fmt.Sprintf(textListMessage, "Moderators", strings.Join(list, textNewlineComma)))
-		}
+	if handler.Role >= roleModerator && !isMod {
 		return
 	}
 
-	if !isAdmin {
+	if handler.Role >= roleAdministrator && !isAdmin {
 		log.Printf("[warning] Non-administrator trying administrator command: %s, %s", command.Command, message.From)
 		return
 	}
 
-	// Commands for administrators
-	switch command.Command {
-	case "/promote":
-		list, errors := telegram.AddModerator(ctx, chatId, CheckMembers(ctx, chatId, command, regular))
-		if len(list) < 1 {
-			telegram.ReplyMessage(ctx, chatId, messageId, "No moderators were added.")
-		} else {
-			telegram.ReplyMessage(ctx, chatId, messageId, fmt.Sprintf(textListMessage, "Added moderator(s)", strings.Join(list, textNewlineComma)))
-		}
-		if len(errors) > 0 {
-			telegram.ReplyMessage(ctx, chatId, messageId, fmt.Sprintf("Errors: %s.", strings.Join(errors, "; ")))
-		}
-	case "/demote":
-		list, errors := telegram.RemoveModerator(ctx, chatId, CheckMembers(ctx, chatId, command, moderators))
-		if len(list) < 1 {
-			telegram.ReplyMessage(ctx, chatId, messageId, "No moderators were removed.")
-		} else {
-			telegram.ReplyMessage(ctx, chatId, messageId, fmt.Sprintf(textListMessage, "Removed moderator(s)", strings.Join(list, textNewlineComma)))
-		}
-		if len(errors) > 0 {
-			telegram.ReplyMessage(ctx, chatId, messageId, fmt.Sprintf("Errors: %s.", strings.Join(errors, "; ")))
-		}
-	}
-
+	handler.Handle(ctx, &commandRequest{
+		Message:   message,
+		Command:   command,
+		ChatId:    chatId,
+		MessageId: messageId,
+		IsAdmin:   isAdmin,
+		Handler:   handler,
+	})
 	return
 }
 
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"github.com/freshautomations/telegram-moderator-bot/telegram"
+	"reflect"
+	"testing"
+)
+
+func TestParseInput(t *testing.T) {
+	spammer := &telegram.User{Id: 42, FirstName: "Spammer"}
+	reply := &telegram.Message{From: spammer}
+	command := func(length int) *telegram.MessageEntity {
+		return &telegram.MessageEntity{Type: "bot_command", Offset: 0, Length: length}
+	}
+	mention := func(offset, length int) *telegram.MessageEntity {
+		return &telegram.MessageEntity{Type: "mention", Offset: offset, Length: length}
+	}
+
+	tests := []struct {
+		name    string
+		message *telegram.Message
+		want    *CommandData
+	}{
+		{
+			name:    "mention and reason",
+			message: &telegram.Message{Text: "/ban @spammer posting scam links", Entities: []*telegram.MessageEntity{command(4), mention(5, 8)}},
+			want:    &CommandData{Command: "/ban", UserStrings: []string{"spammer"}, Reason: "posting scam links"},
+		},
+		{
+			name:    "mention after emoji",
+			message: &telegram.Message{Text: "/ban 😀 @spammer", Entities: []*telegram.MessageEntity{command(4), mention(8, 8)}},
+			want:    &CommandData{Command: "/ban", UserStrings: []string{"spammer"}, Reason: "😀"},
+		},
+		{
+			name: "text mention",
+			message: &telegram.Message{Text: "/warn Spammer flood", Entities: []*telegram.MessageEntity{
+				command(5), {Type: "text_mention", Offset: 6, Length: 7, User: spammer}}},
+			want: &CommandData{Command: "/warn", Users: []*telegram.User{spammer}, Reason: "flood"},
+		},
+		{
+			name:    "numeric user IDs",
+			message: &telegram.Message{Text: "/ban 123 456 spam", Entities: []*telegram.MessageEntity{command(4)}},
+			want:    &CommandData{Command: "/ban", UserIds: []int{123, 456}, Reason: "spam"},
+		},
+		{
+			name:    "words between mentions",
+			message: &telegram.Message{Text: "/ban @a spam 7 @b flood", Entities: []*telegram.MessageEntity{command(4), mention(5, 2), mention(15, 2)}},
+			want:    &CommandData{Command: "/ban", UserStrings: []string{"a", "b"}, Reason: "spam 7 flood"},
+		},
+		{
+			name:    "mention then number",
+			message: &telegram.Message{Text: "/warn @alice 3 times spamming", Entities: []*telegram.MessageEntity{command(5), mention(6, 6)}},
+			want:    &CommandData{Command: "/warn", UserStrings: []string{"alice"}, Reason: "3 times spamming"},
+		},
+		{
+			name:    "mention then only a number",
+			message: &telegram.Message{Text: "/ban @alice 42", Entities: []*telegram.MessageEntity{command(4), mention(5, 6)}},
+			want:    &CommandData{Command: "/ban", UserStrings: []string{"alice"}, Reason: "42"},
+		},
+		{
+			name:    "user IDs then mention",
+			message: &telegram.Message{Text: "/ban 123 456 @alice spam 7", Entities: []*telegram.MessageEntity{command(4), mention(13, 6)}},
+			want:    &CommandData{Command: "/ban", UserStrings: []string{"alice"}, UserIds: []int{123, 456}, Reason: "spam 7"},
+		},
+		{
+			name:    "reason word then number",
+			message: &telegram.Message{Text: "/ban spam 7", Entities: []*telegram.MessageEntity{command(4)}},
+			want:    &CommandData{Command: "/ban", Reason: "spam 7"},
+		},
+		{
+			name:    "reply target",
+			message: &telegram.Message{Text: "/ban", Entities: []*telegram.MessageEntity{command(4)}, ReplyToMessage: reply},
+			want:    &CommandData{Command: "/ban", Users: []*telegram.User{spammer}},
+		},
+		{
+			name:    "numbers in a reply are the reason",
+			message: &telegram.Message{Text: "/warn 3 times spamming", Entities: []*telegram.MessageEntity{command(5)}, ReplyToMessage: reply},
+			want:    &CommandData{Command: "/warn", Users: []*telegram.User{spammer}, Reason: "3 times spamming"},
+		},
+		{
+			name:    "addressed to the bot",
+			message: &telegram.Message{Text: "/ban@ourmodbot @spammer", Entities: []*telegram.MessageEntity{command(14), mention(15, 8)}},
+			want:    &CommandData{Command: "/ban", UserStrings: []string{"spammer"}},
+		},
+		{
+			name:    "addressed to another bot",
+			message: &telegram.Message{Text: "/ban@OtherBot @spammer", Entities: []*telegram.MessageEntity{command(13), mention(14, 8)}},
+		},
+		{
+			name:    "caption",
+			message: &telegram.Message{Caption: "/warn @spammer", CaptionEntities: []*telegram.MessageEntity{command(5), mention(6, 8)}},
+			want:    &CommandData{Command: "/warn", UserStrings: []string{"spammer"}},
+		},
+		{
+			name:    "command entity after a nil entity",
+			message: &telegram.Message{Text: "/ban @spammer", Entities: []*telegram.MessageEntity{nil, command(4), mention(5, 8)}},
+			want:    &CommandData{Command: "/ban", UserStrings: []string{"spammer"}},
+		},
+		{
+			name:    "no entities",
+			message: &telegram.Message{Text: "/ban @spammer"},
+		},
+		{
+			name:    "not a command",
+			message: &telegram.Message{Text: "hello @spammer", Entities: []*telegram.MessageEntity{mention(6, 8)}},
+		},
+		{
+			name:    "command entity past the end",
+			message: &telegram.Message{Text: "/ban", Entities: []*telegram.MessageEntity{command(10)}},
+		},
+		{
+			name:    "malformed mentions are skipped",
+			message: &telegram.Message{Text: "/ban @spammer", Entities: []*telegram.MessageEntity{command(4), mention(5, 20), mention(-3, 2), mention(5, 1)}},
+			want:    &CommandData{Command: "/ban", Reason: "@spammer"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ParseInput(test.message, "OurModBot")
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseInput(%q) = %+v; want %+v", test.message.Text+test.message.Caption, got, test.want)
+			}
+		})
+	}
+}
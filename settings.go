@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/freshautomations/telegram-moderator-bot/context"
+	"github.com/freshautomations/telegram-moderator-bot/db"
+	"github.com/freshautomations/telegram-moderator-bot/duration"
+	"github.com/freshautomations/telegram-moderator-bot/escalation"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings help text. X will be replaced with backtick.
+const textSettingsHelp = `Usage: X/set name valueX
+
+XwarnexpiryX - Warnings stop counting after this long. Example: X/set warnexpiry 30dX
+XwarndecayX - One warning, the oldest one, stops counting every time this much time passes. Example: X/set warndecay 7dX
+XescalationX - What happens at each warning: XnoteX, XmuteX, Xmute:durationX, XbanX or Xban:durationX. Example: X/set escalation note,mute:1h,mute:1d,banX
+XconfirmusersX - X/banX, X/tbanX, X/muteX and X/warnX against more users than this have to be confirmed. Example: X/set confirmusers 3X
+XconfirmageX - X/banX, X/tbanX, X/muteX and X/warnX against users that the bot has seen (in any supergroup) for longer than this have to be confirmed. Example: X/set confirmage 30dX
+
+Use XoffX as the value to turn a setting off or to go back to the default escalation.`
+
+// Composed settings text.
+const textSettingsMessage = `Settings:
+XwarnexpiryX: %s
+XwarndecayX: %s
+XescalationX: %s
+XconfirmusersX: %s
+XconfirmageX: %s`
+
+// Value that turns a setting off.
+const settingOff = "off"
+
+// Formats the settings of a supergroup.
+func chatSettingsText(ctx *context.Context, settings *db.ChatSettings) string {
+	policy := GetEscalationPolicy(ctx, settings).String()
+	if settings.Escalation == "" {
+		policy += " (default)"
+	}
+
+	return strings.Replace(fmt.Sprintf(textSettingsMessage,
+		formatSeconds(settings.WarnExpiry),
+		formatSeconds(settings.WarnDecay),
+		policy,
+		formatCount(settings.ConfirmUsers),
+		formatSeconds(settings.ConfirmAge)), "X", "`", -1)
+}
+
+// Changes a setting of a supergroup based on the arguments of the /set command.
+func setChatSetting(settings *db.ChatSettings, args []string) error {
+	if len(args) != 2 {
+		return errors.New(strings.Replace(textSettingsHelp, "X", "`", -1))
+	}
+
+	name, value := strings.ToLower(args[0]), args[1]
+	switch name {
+	case "warnexpiry":
+		seconds, err := parseSeconds(value)
+		if err != nil {
+			return err
+		}
+		settings.WarnExpiry = seconds
+	case "warndecay":
+		seconds, err := parseSeconds(value)
+		if err != nil {
+			return err
+		}
+		settings.WarnDecay = seconds
+	case "escalation":
+		if strings.ToLower(value) == settingOff {
+			settings.Escalation = ""
+			break
+		}
+		policy, err := escalation.Parse(value)
+		if err != nil {
+			return err
+		}
+		settings.Escalation = policy.String()
+	case "confirmusers":
+		count, err := parseCount(value)
+		if err != nil {
+			return err
+		}
+		settings.ConfirmUsers = count
+	case "confirmage":
+		seconds, err := parseSeconds(value)
+		if err != nil {
+			return err
+		}
+		settings.ConfirmAge = seconds
+	default:
+		return fmt.Errorf("Unknown setting: %s.", name)
+	}
+
+	return nil
+}
+
+// Parses a duration setting into seconds. "off" is zero.
+func parseSeconds(value string) (int64, error) {
+	if strings.ToLower(value) == settingOff {
+		return 0, nil
+	}
+	d, err := duration.Parse(value)
+	if err != nil {
+		return 0, err
+	}
+	return int64(d / time.Second), nil
+}
+
+// Formats a duration setting stored in seconds.
+func formatSeconds(seconds int64) string {
+	if seconds == 0 {
+		return settingOff
+	}
+	return duration.Format(time.Duration(seconds) * time.Second)
+}
+
+// Parses a number setting. "off" is zero.
+func parseCount(value string) (int, error) {
+	if strings.ToLower(value) == settingOff {
+		return 0, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("Invalid number: %s.", value)
+	}
+	return count, nil
+}
+
+// Formats a number setting.
+func formatCount(count int) string {
+	if count == 0 {
+		return settingOff
+	}
+	return strconv.Itoa(count)
+}
@@ -0,0 +1,122 @@
+package telegram
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/freshautomations/telegram-moderator-bot/defaults"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// apiResponse is implemented by every response type through the embedded Response.
+type apiResponse interface {
+	envelope() *Response
+}
+
+// Client is a Telegram Bot API client.
+type Client struct {
+	// Bot API base URL without the token, for example https://api.telegram.org/bot
+	BaseURL string
+
+	// Bot token
+	Token string
+
+	// HTTP client used for the API calls
+	HTTPClient *http.Client
+
+	// Rate limit of outgoing messages. Nil means no limit.
+	Throttle *Throttle
+
+	// Longest time a call waits in total for retries and the throttle. Calls that would wait longer fail.
+	// In webhook mode it is shorter than the function timeout, so the update is answered in time.
+	MaxWait time.Duration
+}
+
+// NewClient creates a Client for the given bot token. An empty BaseURL uses the public Bot API.
+// The HTTP client times out after defaults.TelegramTimeout and messages are throttled to Telegram's limits.
+// Calls wait at most defaults.TelegramMaxWait for retries and the throttle.
+func NewClient(BaseURL string, Token string) *Client {
+	if BaseURL == "" {
+		BaseURL = defaults.TelegramAPIBase
+	}
+	return &Client{
+		BaseURL:    BaseURL,
+		Token:      Token,
+		HTTPClient: &http.Client{Timeout: defaults.TelegramTimeout},
+		Throttle: NewThrottle(defaults.TelegramChatMessageLimit, time.Minute,
+			defaults.TelegramGlobalMessageLimit, time.Second),
+		MaxWait: defaults.TelegramMaxWait,
+	}
+}
+
+// Call sends Request as JSON to a Bot API method and decodes the answer into Incoming.
+// Most methods are not idempotent: a request that reached Telegram may have been carried out even if the answer
+// got lost, so only requests that provably did not reach Telegram (the connection could not be opened) and
+// rate limits are retried with backoff, waiting at least the retry_after time that Telegram asks for, as long as
+// the total wait stays within MaxWait.
+// Only transport and decoding errors are returned, the callers check the Ok field of the response.
+func (c *Client) Call(Method string, Request interface{}, Incoming apiResponse) error {
+	jsonValue, err := json.Marshal(Request)
+	if err != nil {
+		return err
+	}
+
+	backoff := defaults.TelegramRetryBackoff
+	var waited time.Duration
+	for attempt := 0; ; attempt++ {
+		var statusCode int
+		var unsent bool
+		statusCode, unsent, err = c.post(Method, jsonValue, Incoming)
+
+		envelope := Incoming.envelope()
+		wait := backoff
+		switch {
+		case err != nil:
+			if !unsent {
+				return err
+			}
+		case envelope.Ok:
+			return nil
+		case envelope.ErrorCode == http.StatusTooManyRequests:
+			if envelope.Parameters != nil && envelope.Parameters.RetryAfter > 0 {
+				wait = time.Duration(envelope.Parameters.RetryAfter) * time.Second
+			}
+		default:
+			return nil
+		}
+
+		if attempt >= defaults.TelegramRetries || waited+wait > c.MaxWait {
+			return err
+		}
+		log.Printf("[warning] %s failed (HTTP %d), retrying in %s", Method, statusCode, wait)
+		time.Sleep(wait)
+		waited += wait
+		backoff *= 2
+	}
+}
+
+// post sends one request and decodes the answer into Incoming. It returns the HTTP status code and whether
+// the request failed before it could reach Telegram.
+func (c *Client) post(Method string, jsonValue []byte, Incoming apiResponse) (statusCode int, unsent bool, err error) {
+	*Incoming.envelope() = Response{}
+
+	m, err := c.HTTPClient.Post(c.BaseURL+c.Token+"/"+Method, defaults.ContentType, bytes.NewBuffer(jsonValue))
+	if err != nil {
+		// The URL holds the token, keep it out of the logs.
+		if urlError, ok := err.(*url.Error); ok {
+			opError, ok := urlError.Err.(*net.OpError)
+			return 0, ok && opError.Op == "dial", fmt.Errorf("%s: %v", Method, urlError.Err)
+		}
+		return 0, false, err
+	}
+	defer m.Body.Close()
+
+	if err = json.NewDecoder(m.Body).Decode(Incoming); err != nil {
+		return m.StatusCode, false, fmt.Errorf("%s decoder (HTTP %d): %v", Method, m.StatusCode, err)
+	}
+	return m.StatusCode, false, nil
+}
@@ -0,0 +1,81 @@
+package telegram
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testServer answers the first failures calls with 429 and the given retry_after, and the rest with success.
+// It returns the client that calls it and the number of calls it received.
+func testServer(t *testing.T, failures int32, RetryAfter int, MaxWait time.Duration) (*Client, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			fmt.Fprintf(w, `{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":%d}}`, RetryAfter)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true,"result":true}`)
+	}))
+	t.Cleanup(server.Close)
+	return &Client{BaseURL: server.URL + "/bot", Token: "token", HTTPClient: server.Client(), MaxWait: MaxWait}, &calls
+}
+
+func TestCallRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int32
+		retryAfter int
+		maxWait    time.Duration
+		wantCalls  int32
+		wantOk     bool
+	}{
+		{"success", 0, 0, time.Second, 1, true},
+		{"429 retried after retry_after", 1, 1, 2 * time.Second, 2, true},
+		{"429 retried with backoff", 2, 0, 2 * time.Second, 3, true},
+		{"retry_after longer than MaxWait", 1, 2, time.Second, 1, false},
+		{"backoff stops at MaxWait", 5, 0, time.Second, 2, false},
+		{"no waiting allowed", 1, 0, 0, 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, calls := testServer(t, test.failures, test.retryAfter, test.maxWait)
+			incoming := &DeleteMyCommandsResponse{}
+			start := time.Now()
+			if err := client.Call("deleteMyCommands", struct{}{}, incoming); err != nil {
+				t.Fatalf("Call() error = %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > test.maxWait+time.Second {
+				t.Errorf("Call() took %s; MaxWait is %s", elapsed, test.maxWait)
+			}
+			if got := atomic.LoadInt32(calls); got != test.wantCalls {
+				t.Errorf("calls = %d; want %d", got, test.wantCalls)
+			}
+			if incoming.Ok != test.wantOk {
+				t.Errorf("Ok = %t; want %t", incoming.Ok, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestCallDoesNotRetryServerErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, `{"ok":false,"error_code":502,"description":"Bad Gateway"}`)
+	}))
+	defer server.Close()
+
+	// The request may have been carried out, sending it again could send a message twice.
+	client := &Client{BaseURL: server.URL + "/bot", Token: "token", HTTPClient: server.Client(), MaxWait: 10 * time.Second}
+	if err := client.Call("sendMessage", struct{}{}, &SendMessageResponse{}); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d; want 1", calls)
+	}
+}
@@ -0,0 +1,54 @@
+package telegram
+
+import (
+	"unicode/utf8"
+)
+
+// Telegram counts entity offsets and lengths in UTF-16 code units, Go strings are indexed by bytes.
+// The functions below convert between the two and never panic on malformed entities.
+
+// Convert a UTF-16 offset in the text to a byte offset. Returns false if the offset is outside of the text
+// or points into the middle of a character.
+func ByteOffset(Text string, Utf16Offset int) (int, bool) {
+	if Utf16Offset < 0 {
+		return 0, false
+	}
+
+	units := 0
+	for i, r := range Text {
+		if units == Utf16Offset {
+			return i, true
+		}
+		if units > Utf16Offset {
+			return 0, false
+		}
+		units += utf16Length(r)
+	}
+	if units == Utf16Offset {
+		return len(Text), true
+	}
+	return 0, false
+}
+
+// Get the byte offsets of the part of the text that the entity covers.
+func EntityBounds(Text string, Entity *MessageEntity) (start, end int, ok bool) {
+	if Entity == nil || Entity.Length < 0 {
+		return 0, 0, false
+	}
+	if start, ok = ByteOffset(Text, Entity.Offset); !ok {
+		return 0, 0, false
+	}
+	if end, ok = ByteOffset(Text, Entity.Offset+Entity.Length); !ok {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// Number of UTF-16 code units needed to encode the rune. Invalid UTF-8 bytes are decoded as
+// utf8.RuneError by range loops, which is a single code unit.
+func utf16Length(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
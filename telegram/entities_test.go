@@ -0,0 +1,104 @@
+package telegram
+
+import (
+	"testing"
+	"unicode/utf16"
+)
+
+// Largest int, the overflowing lengths below wrap around when added to the offset.
+const maxInt = int(^uint(0) >> 1)
+
+func TestByteOffset(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		offset int
+		want   int
+		ok     bool
+	}{
+		{"start", "/ban @user", 0, 0, true},
+		{"ascii", "/ban @user", 5, 5, true},
+		{"end of text", "/ban", 4, 4, true},
+		{"past the end", "/ban", 5, 0, false},
+		{"negative", "/ban", -1, 0, false},
+		{"overflowing", "/ban", maxInt, 0, false},
+		{"empty text", "", 0, 0, true},
+		{"two-byte rune", "/ban é @user", 7, 8, true},
+		{"three-byte rune", "/ban € @user", 7, 9, true},
+		{"after surrogate pair", "/ban 😀 @user", 8, 10, true},
+		{"inside surrogate pair", "/ban 😀 @user", 6, 0, false},
+		{"invalid utf-8", "/ban \xff @user", 7, 7, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := ByteOffset(test.text, test.offset)
+			if got != test.want || ok != test.ok {
+				t.Errorf("ByteOffset(%q, %d) = %d, %v; want %d, %v", test.text, test.offset, got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestEntityBounds(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		entity *MessageEntity
+		want   string
+		ok     bool
+	}{
+		{"command", "/ban @user", &MessageEntity{Offset: 0, Length: 4}, "/ban", true},
+		{"mention", "/ban @user spam", &MessageEntity{Offset: 5, Length: 5}, "@user", true},
+		{"mention after emoji", "/ban 😀 @user", &MessageEntity{Offset: 8, Length: 5}, "@user", true},
+		{"emoji mention", "/ban @😀", &MessageEntity{Offset: 5, Length: 3}, "@😀", true},
+		{"empty", "/ban", &MessageEntity{Offset: 4, Length: 0}, "", true},
+		{"nil entity", "/ban", nil, "", false},
+		{"negative offset", "/ban", &MessageEntity{Offset: -1, Length: 2}, "", false},
+		{"negative length", "/ban", &MessageEntity{Offset: 2, Length: -1}, "", false},
+		{"length past the end", "/ban @user", &MessageEntity{Offset: 5, Length: 6}, "", false},
+		{"offset past the end", "/ban", &MessageEntity{Offset: 10, Length: 1}, "", false},
+		{"overflowing length", "/ban", &MessageEntity{Offset: 1, Length: maxInt}, "", false},
+		{"splits surrogate pair", "/ban 😀", &MessageEntity{Offset: 5, Length: 1}, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end, ok := EntityBounds(test.text, test.entity)
+			if ok != test.ok {
+				t.Fatalf("EntityBounds(%q, %+v) ok = %v; want %v", test.text, test.entity, ok, test.ok)
+			}
+			if ok && test.text[start:end] != test.want {
+				t.Errorf("EntityBounds(%q, %+v) = %q; want %q", test.text, test.entity, test.text[start:end], test.want)
+			}
+		})
+	}
+}
+
+func FuzzEntityBounds(f *testing.F) {
+	f.Add("/ban @user spam", 5, 5)
+	f.Add("/ban 😀 @user", 8, 5)
+	f.Add("/ban 😀", 5, 1)
+	f.Add("/ban \xff\xfe @user", 8, 5)
+	f.Add("", 0, 0)
+	f.Add("/ban", -1, 2)
+	f.Add("/ban", 1, maxInt)
+	f.Fuzz(func(t *testing.T, text string, offset, length int) {
+		start, end, ok := EntityBounds(text, &MessageEntity{Offset: offset, Length: length})
+		if !ok {
+			return
+		}
+		if start < 0 || start > end || end > len(text) {
+			t.Fatalf("EntityBounds(%q, %d, %d) = %d, %d: out of range", text, offset, length, start, end)
+		}
+		if got := utf16Units(text[:start]); got != offset {
+			t.Errorf("EntityBounds(%q, %d, %d): start %d is at UTF-16 offset %d", text, offset, length, start, got)
+		}
+		if got := utf16Units(text[start:end]); got != length {
+			t.Errorf("EntityBounds(%q, %d, %d): entity %q is %d UTF-16 units long", text, offset, length, text[start:end], got)
+		}
+	})
+}
+
+// Number of UTF-16 code units of the text as Telegram counts them.
+func utf16Units(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
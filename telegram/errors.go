@@ -0,0 +1,95 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Common Bot API failures. Use Kind or errors.Is to find out which one an APIError is.
+var (
+	ErrNotEnoughRights     = errors.New("the bot does not have enough rights")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrUserIsAdministrator = errors.New("user is an administrator of the chat")
+	ErrChatNotFound        = errors.New("chat not found")
+	ErrBotKicked           = errors.New("the bot was removed from the chat")
+	ErrMessageNotFound     = errors.New("the message does not exist anymore")
+	ErrMessageNotDeletable = errors.New("the message is too old or the bot can not delete messages")
+
+	// Returned without calling the Bot API when a message would exceed Telegram's rate limits
+	ErrThrottled = errors.New("too many messages were sent to the chat, try again later")
+)
+
+// Parts of the Bot API error descriptions that identify the common failures.
+var errorDescriptions = []struct {
+	Text string
+	Kind error
+}{
+	{"not enough rights", ErrNotEnoughRights},
+	{"chat_admin_required", ErrNotEnoughRights},
+	{"have no rights", ErrNotEnoughRights},
+	{"user not found", ErrUserNotFound},
+	{"user_id_invalid", ErrUserNotFound},
+	{"participant_id_invalid", ErrUserNotFound},
+	{"user is an administrator", ErrUserIsAdministrator},
+	{"can't remove chat owner", ErrUserIsAdministrator},
+	{"user_admin_invalid", ErrUserIsAdministrator},
+	{"chat not found", ErrChatNotFound},
+	{"bot was kicked", ErrBotKicked},
+	{"bot is not a member", ErrBotKicked},
+	{"message to delete not found", ErrMessageNotFound},
+	{"message can't be deleted", ErrMessageNotDeletable},
+}
+
+// APIError is a failure answer of the Bot API.
+type APIError struct {
+	Code        int
+	Description string
+
+	// One of the common failures above or nil if the failure is not one of them
+	Kind error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Description)
+}
+
+// Unwrap returns the kind of the failure, so errors.Is can match it.
+func (e *APIError) Unwrap() error {
+	return e.Kind
+}
+
+// Err returns the failure of the response as an APIError, or nil if the call succeeded.
+func (r *Response) Err() error {
+	if r.Ok {
+		return nil
+	}
+	apiError := &APIError{Code: r.ErrorCode, Description: r.Description}
+	description := strings.ToLower(r.Description)
+	for _, known := range errorDescriptions {
+		if strings.Contains(description, known.Text) {
+			apiError.Kind = known.Kind
+			break
+		}
+	}
+	return apiError
+}
+
+// Explain turns an error of an API call into a short explanation for the chat.
+func Explain(err error) string {
+	if apiError, ok := err.(*APIError); ok {
+		if apiError.Kind != nil {
+			return apiError.Kind.Error()
+		}
+		return apiError.Description
+	}
+	if err == ErrThrottled {
+		return err.Error()
+	}
+	return "Telegram could not be reached"
+}
+
+// failure formats the explanation of a failed call about a user.
+func failure(user *User, err error) string {
+	return fmt.Sprintf("[%s](tg://user?id=%d): %s", user.String(), user.Id, Explain(err))
+}
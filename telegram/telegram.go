@@ -1,17 +1,16 @@
 package telegram
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"github.com/freshautomations/telegram-moderator-bot/context"
-	"github.com/freshautomations/telegram-moderator-bot/db"
 	"github.com/freshautomations/telegram-moderator-bot/defaults"
 	"log"
-	"net/http"
+	"strings"
+	"time"
 )
 
+// Replaces the Markdown special characters with their escaped version.
+var markdownEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
 type User struct {
 	Id           int    `json:"id"`
 	IsBot        bool   `json:"is_bot"`
@@ -33,19 +32,20 @@ func (u User) String() string {
 }
 
 type Chat struct {
-	Id                          int64      `json:"id"`
-	Type                        string     `json:"type"`
-	Title                       string     `json:"title"`
-	Username                    string     `json:"username"`
-	FirstName                   string     `json:"first_name"`
-	LastName                    string     `json:"last_name"`
-	AllMembersAreAdministrators bool       `json:"all_members_are_administrators"`
-	Photo                       *ChatPhoto `json:"photo"`
-	Description                 string     `json:"description"`
-	InviteLink                  string     `json:"invite_link"`
-	PinnedMessage               *Message   `json:"pinned_message"`
-	StickerSetName              string     `json:"sticker_set_name"`
-	CanSetStickerSet            bool       `json:"can_set_sticker_set"`
+	Id                          int64            `json:"id"`
+	Type                        string           `json:"type"`
+	Title                       string           `json:"title"`
+	Username                    string           `json:"username"`
+	FirstName                   string           `json:"first_name"`
+	LastName                    string           `json:"last_name"`
+	AllMembersAreAdministrators bool             `json:"all_members_are_administrators"`
+	Photo                       *ChatPhoto       `json:"photo"`
+	Description                 string           `json:"description"`
+	InviteLink                  string           `json:"invite_link"`
+	PinnedMessage               *Message         `json:"pinned_message"`
+	StickerSetName              string           `json:"sticker_set_name"`
+	CanSetStickerSet            bool             `json:"can_set_sticker_set"`
+	Permissions                 *ChatPermissions `json:"permissions"`
 }
 
 type ChatPhoto struct {
@@ -235,50 +235,51 @@ type EncryptedCredentials struct {
 }
 
 type Message struct {
-	MessageId             int64              `json:"message_id"`
-	From                  *User              `json:"from"`
-	Date                  int                `json:"date"`
-	Chat                  *Chat              `json:"chat"`
-	ForwardFrom           *User              `json:"forward_from"`
-	ForwardFromChat       *Chat              `json:"forward_from_chat"`
-	ForwardFromMessageId  int                `json:"forward_from_message_id"`
-	ForwardSignature      string             `json:"forward_signature"`
-	ForwardDate           int                `json:"forward_date"`
-	ReplyToMessage        *Message           `json:"reply_to_message"`
-	EditDate              int                `json:"edit_date"`
-	MediaGroupId          string             `json:"media_group_id"`
-	AuthorSignature       string             `json:"author_signature"`
-	Text                  string             `json:"text"`
-	Entities              []*MessageEntity   `json:"entities"`
-	CaptionEntities       []*MessageEntity   `json:"caption_entities"`
-	Audio                 *Audio             `json:"audio"`
-	Document              *Document          `json:"document"`
-	Animation             *Animation         `json:"animation"`
-	Game                  *Game              `json:"game"`
-	Photo                 []*PhotoSize       `json:"photo"`
-	Sticker               *Sticker           `json:"sticker"`
-	Video                 *Video             `json:"video"`
-	Voice                 *Voice             `json:"voice"`
-	VideoNote             *VideoNote         `json:"video_note"`
-	Caption               string             `json:"caption"`
-	Contact               *Contact           `json:"contact"`
-	Location              *Location          `json:"location"`
-	Venue                 *Venue             `json:"venue"`
-	NewChatMembers        []*User            `json:"new_chat_members"`
-	LeftChatMember        *User              `json:"left_chat_member"`
-	NewChatTitle          string             `json:"new_chat_title"`
-	NewChatPhoto          []*PhotoSize       `json:"new_chat_photo"`
-	DeleteChatPhoto       bool               `json:"delete_chat_photo"`
-	GroupChatCreated      bool               `json:"group_chat_created"`
-	SupergroupChatCreated bool               `json:"supergroup_chat_created"`
-	ChannelChatCreated    bool               `json:"channel_chat_created"`
-	MigrateToChatId       int64              `json:"migrate_to_chat_id"`
-	MigrateFromChatId     int64              `json:"migrate_from_chat_id"`
-	PinnedMessage         *Message           `json:"pinned_message"`
-	Invoice               *Invoice           `json:"invoice"`
-	SuccessfulPayment     *SuccessfulPayment `json:"successful_payment"`
-	ConnectedWebsite      string             `json:"connected_website"`
-	PassportData          *PassportData      `json:"passport_data"`
+	MessageId             int64                 `json:"message_id"`
+	From                  *User                 `json:"from"`
+	Date                  int                   `json:"date"`
+	Chat                  *Chat                 `json:"chat"`
+	ForwardFrom           *User                 `json:"forward_from"`
+	ForwardFromChat       *Chat                 `json:"forward_from_chat"`
+	ForwardFromMessageId  int                   `json:"forward_from_message_id"`
+	ForwardSignature      string                `json:"forward_signature"`
+	ForwardDate           int                   `json:"forward_date"`
+	ReplyToMessage        *Message              `json:"reply_to_message"`
+	EditDate              int                   `json:"edit_date"`
+	MediaGroupId          string                `json:"media_group_id"`
+	AuthorSignature       string                `json:"author_signature"`
+	Text                  string                `json:"text"`
+	Entities              []*MessageEntity      `json:"entities"`
+	CaptionEntities       []*MessageEntity      `json:"caption_entities"`
+	Audio                 *Audio                `json:"audio"`
+	Document              *Document             `json:"document"`
+	Animation             *Animation            `json:"animation"`
+	Game                  *Game                 `json:"game"`
+	Photo                 []*PhotoSize          `json:"photo"`
+	Sticker               *Sticker              `json:"sticker"`
+	Video                 *Video                `json:"video"`
+	Voice                 *Voice                `json:"voice"`
+	VideoNote             *VideoNote            `json:"video_note"`
+	Caption               string                `json:"caption"`
+	Contact               *Contact              `json:"contact"`
+	Location              *Location             `json:"location"`
+	Venue                 *Venue                `json:"venue"`
+	NewChatMembers        []*User               `json:"new_chat_members"`
+	LeftChatMember        *User                 `json:"left_chat_member"`
+	NewChatTitle          string                `json:"new_chat_title"`
+	NewChatPhoto          []*PhotoSize          `json:"new_chat_photo"`
+	DeleteChatPhoto       bool                  `json:"delete_chat_photo"`
+	GroupChatCreated      bool                  `json:"group_chat_created"`
+	SupergroupChatCreated bool                  `json:"supergroup_chat_created"`
+	ChannelChatCreated    bool                  `json:"channel_chat_created"`
+	MigrateToChatId       int64                 `json:"migrate_to_chat_id"`
+	MigrateFromChatId     int64                 `json:"migrate_from_chat_id"`
+	PinnedMessage         *Message              `json:"pinned_message"`
+	Invoice               *Invoice              `json:"invoice"`
+	SuccessfulPayment     *SuccessfulPayment    `json:"successful_payment"`
+	ConnectedWebsite      string                `json:"connected_website"`
+	PassportData          *PassportData         `json:"passport_data"`
+	ReplyMarkup           *InlineKeyboardMarkup `json:"reply_markup"`
 }
 
 type Update struct {
@@ -292,6 +293,17 @@ type Update struct {
 	CallbackQuery      *CallbackQuery      `json:"callback_query"`
 	ShippingQuery      *ShippingQuery      `json:"shipping_query"`
 	PreCheckoutQuery   *PreCheckoutQuery   `json:"pre_checkout_query"`
+	MyChatMember       *ChatMemberUpdated  `json:"my_chat_member"`
+	ChatMember         *ChatMemberUpdated  `json:"chat_member"`
+}
+
+// ChatMemberUpdated is a change of the status of a chat member. From is the user who made the change.
+type ChatMemberUpdated struct {
+	Chat          *Chat       `json:"chat"`
+	From          *User       `json:"from"`
+	Date          int64       `json:"date"`
+	OldChatMember *ChatMember `json:"old_chat_member"`
+	NewChatMember *ChatMember `json:"new_chat_member"`
 }
 
 type InlineQuery struct {
@@ -356,21 +368,128 @@ type ChatMember struct {
 	CanAddWebPagePreviews bool   `json:"can_add_web_page_previews,omitempty"`
 }
 
+// ResponseParameters tells why a request failed and how it can be retried.
+type ResponseParameters struct {
+	MigrateToChatId int64 `json:"migrate_to_chat_id,omitempty"`
+	RetryAfter      int   `json:"retry_after,omitempty"`
+}
+
+// Response is the envelope of every Bot API answer. The method-specific responses embed it next to their Result.
+type Response struct {
+	Ok          bool                `json:"ok"`
+	ErrorCode   int                 `json:"error_code,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Parameters  *ResponseParameters `json:"parameters,omitempty"`
+}
+
+// envelope gives Client.Call access to the embedded Response.
+func (r *Response) envelope() *Response {
+	return r
+}
+
 type SendMessageRequest struct {
-	ChatId                int64  `json:"chat_id"`
-	Text                  string `json:"text"`
-	ParseMode             string `json:"parse_mode,omitempty"`
-	DisableWebPagePreview bool   `json:"disable_web_page_preview,omitempty"`
-	DisableNotification   bool   `json:"disable_notification,omitempty"`
-	ReplyToMessageId      int64  `json:"reply_to_message_id,omitempty"`
-	//Todo: implement reply_markup
+	ChatId                int64                 `json:"chat_id"`
+	Text                  string                `json:"text"`
+	ParseMode             string                `json:"parse_mode,omitempty"`
+	DisableWebPagePreview bool                  `json:"disable_web_page_preview,omitempty"`
+	DisableNotification   bool                  `json:"disable_notification,omitempty"`
+	ReplyToMessageId      int64                 `json:"reply_to_message_id,omitempty"`
+	ReplyMarkup           *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	Url          string `json:"url,omitempty"`
+	CallbackData string `json:"callback_data,omitempty"`
+}
+
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
+// BotCommand is an entry of the command menu of Telegram clients. The command is written without the slash.
+type BotCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+// Scopes of the command menu.
+const (
+	ScopeDefault               = "default"
+	ScopeAllGroupChats         = "all_group_chats"
+	ScopeAllChatAdministrators = "all_chat_administrators"
+	ScopeChatMember            = "chat_member"
+)
+
+// BotCommandScope selects the chats and users that see a command menu.
+type BotCommandScope struct {
+	Type   string `json:"type"`
+	ChatId int64  `json:"chat_id,omitempty"`
+	UserId int    `json:"user_id,omitempty"`
+}
+
+type SetMyCommandsRequest struct {
+	Commands     []BotCommand     `json:"commands"`
+	Scope        *BotCommandScope `json:"scope,omitempty"`
+	LanguageCode string           `json:"language_code,omitempty"`
+}
+
+type SetMyCommandsResponse struct {
+	Response
+}
+
+type DeleteMyCommandsRequest struct {
+	Scope        *BotCommandScope `json:"scope,omitempty"`
+	LanguageCode string           `json:"language_code,omitempty"`
+}
+
+type DeleteMyCommandsResponse struct {
+	Response
+}
+
+type AnswerCallbackQueryRequest struct {
+	CallbackQueryId string `json:"callback_query_id"`
+	Text            string `json:"text,omitempty"`
+	ShowAlert       bool   `json:"show_alert,omitempty"`
+}
+
+type AnswerCallbackQueryResponse struct {
+	Response
+}
+
+type EditMessageTextRequest struct {
+	ChatId      int64                 `json:"chat_id"`
+	MessageId   int64                 `json:"message_id"`
+	Text        string                `json:"text"`
+	ParseMode   string                `json:"parse_mode,omitempty"`
+	ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type EditMessageTextResponse struct {
+	Response
+}
+
+type DeleteMessageRequest struct {
+	ChatId    int64 `json:"chat_id"`
+	MessageId int64 `json:"message_id"`
+}
+
+type DeleteMessageResponse struct {
+	Response
+}
+
+type DeleteMessagesRequest struct {
+	ChatId     int64   `json:"chat_id"`
+	MessageIds []int64 `json:"message_ids"`
+}
+
+type DeleteMessagesResponse struct {
+	Response
 }
 
 type SendMessageResponse struct {
-	Ok          bool    `json:"ok"`
-	Result      Message `json:"result"`
-	ErrorCode   int     `json:"error_code,omitempty"`
-	Description string  `json:"description,omitempty"`
+	Response
+	Result Message `json:"result"`
 }
 
 type GetChatAdministratorsRequest struct {
@@ -378,10 +497,17 @@ type GetChatAdministratorsRequest struct {
 }
 
 type GetChatAdministratorsResponse struct {
-	Ok          bool          `json:"ok"`
-	Result      []*ChatMember `json:"result"`
-	ErrorCode   int           `json:"error_code,omitempty"`
-	Description string        `json:"description,omitempty"`
+	Response
+	Result []*ChatMember `json:"result"`
+}
+
+type GetChatRequest struct {
+	ChatId int64 `json:"chat_id"`
+}
+
+type GetChatResponse struct {
+	Response
+	Result *Chat `json:"result"`
 }
 
 type GetChatMemberRequest struct {
@@ -390,10 +516,8 @@ type GetChatMemberRequest struct {
 }
 
 type GetChatMemberResponse struct {
-	Ok          bool        `json:"ok"`
-	Result      *ChatMember `json:"result"`
-	ErrorCode   int         `json:"error_code,omitempty"`
-	Description string      `json:"description,omitempty"`
+	Response
+	Result *ChatMember `json:"result"`
 }
 
 type PromoteChatMemberRequest struct {
@@ -410,9 +534,7 @@ type PromoteChatMemberRequest struct {
 }
 
 type PromoteChatMemberResponse struct {
-	Ok          bool   `json:"ok"`
-	ErrorCode   int    `json:"error_code,omitempty"`
-	Description string `json:"description,omitempty"`
+	Response
 }
 
 type KickChatMemberRequest struct {
@@ -422,62 +544,126 @@ type KickChatMemberRequest struct {
 }
 
 type KickChatMemberResponse struct {
-	Ok          bool   `json:"ok"`
-	ErrorCode   int    `json:"error_code,omitempty"`
-	Description string `json:"description,omitempty"`
+	Response
+}
+
+type ChatPermissions struct {
+	CanSendMessages       bool `json:"can_send_messages"`
+	CanSendMediaMessages  bool `json:"can_send_media_messages"`
+	CanSendPolls          bool `json:"can_send_polls"`
+	CanSendOtherMessages  bool `json:"can_send_other_messages"`
+	CanAddWebPagePreviews bool `json:"can_add_web_page_previews"`
+	CanChangeInfo         bool `json:"can_change_info"`
+	CanInviteUsers        bool `json:"can_invite_users"`
+	CanPinMessages        bool `json:"can_pin_messages"`
+}
+
+type RestrictChatMemberRequest struct {
+	ChatId      int64            `json:"chat_id"`
+	UserId      int              `json:"user_id"`
+	Permissions *ChatPermissions `json:"permissions"`
+	UntilDate   int64            `json:"until_date,omitempty"`
+}
+
+type RestrictChatMemberResponse struct {
+	Response
+}
+
+type GetUpdatesRequest struct {
+	Offset         int      `json:"offset,omitempty"`
+	Timeout        int      `json:"timeout,omitempty"`
+	AllowedUpdates []string `json:"allowed_updates,omitempty"`
+}
+
+type GetUpdatesResponse struct {
+	Response
+	Result []*Update `json:"result"`
+}
+
+type SetWebhookRequest struct {
+	Url            string   `json:"url"`
+	MaxConnections int      `json:"max_connections,omitempty"`
+	AllowedUpdates []string `json:"allowed_updates"`
+	SecretToken    string   `json:"secret_token,omitempty"`
+}
+
+// EmptyRequest is the request of the methods without parameters.
+type EmptyRequest struct{}
+
+type WebhookResponse struct {
+	Response
+}
+
+type WebhookInfo struct {
+	Url                  string   `json:"url"`
+	HasCustomCertificate bool     `json:"has_custom_certificate"`
+	PendingUpdateCount   int      `json:"pending_update_count"`
+	IpAddress            string   `json:"ip_address,omitempty"`
+	LastErrorDate        int64    `json:"last_error_date,omitempty"`
+	LastErrorMessage     string   `json:"last_error_message,omitempty"`
+	MaxConnections       int      `json:"max_connections,omitempty"`
+	AllowedUpdates       []string `json:"allowed_updates,omitempty"`
+}
+
+type GetWebhookInfoResponse struct {
+	Response
+	Result *WebhookInfo `json:"result"`
+}
+
+type GetMeResponse struct {
+	Response
+	Result *User `json:"result"`
 }
 
 // Reply to a user's message in a supergroup.
-func ReplyMessage(ctx *context.Context, ChatId int64, ReplyToMessageId int64, Text string) error {
-	jsonValue, _ := json.Marshal(SendMessageRequest{
+func (c *Client) ReplyMessage(ChatId int64, ReplyToMessageId int64, Text string) error {
+	return c.ReplyMessageWithKeyboard(ChatId, ReplyToMessageId, Text, nil)
+}
+
+// Reply to a user's message in a supergroup with inline keyboard buttons under the reply.
+func (c *Client) ReplyMessageWithKeyboard(ChatId int64, ReplyToMessageId int64, Text string, Keyboard *InlineKeyboardMarkup) error {
+	if c.Throttle != nil && !c.Throttle.Wait(ChatId, c.MaxWait) {
+		log.Printf("[warning] ReplyMessage to %d dropped: %v", ChatId, ErrThrottled)
+		return ErrThrottled
+	}
+
+	incoming := &SendMessageResponse{}
+	err := c.Call("sendMessage", SendMessageRequest{
 		ChatId:              ChatId,
 		Text:                Text,
 		ReplyToMessageId:    ReplyToMessageId,
 		DisableNotification: true,
 		ParseMode:           "Markdown",
-	})
-
-	m, err := http.Post(defaults.TelegramAPIBase+ctx.Cfg.TelegramToken+"/sendMessage", defaults.ContentType, bytes.NewBuffer(jsonValue))
+		ReplyMarkup:         Keyboard,
+	}, incoming)
 	if err != nil {
-		log.Printf("[error] Telegram API response: %v", err)
+		log.Printf("[error] ReplyMessage: %v", err)
 		return err
 	}
 
-	incoming := &SendMessageResponse{}
-	err = json.NewDecoder(m.Body).Decode(incoming)
-	if err != nil {
-		log.Printf("[error] ReplyMessage decoder: %v", err)
+	if err = incoming.Err(); err != nil {
+		log.Printf("[error] ReplyMessage %v.", err)
 		return err
 	}
 
-	if incoming.Ok {
-		if defaults.Debug {
-			log.Printf("[debug] ReplyMessage: %s", incoming.Result.Text)
-		}
-	} else {
-		log.Printf("[error] ReplyMessage %d %s.", incoming.ErrorCode, incoming.Description)
-		return errors.New(incoming.Description)
+	if defaults.Debug {
+		log.Printf("[debug] ReplyMessage: %s", incoming.Result.Text)
 	}
 
 	return nil
 }
 
 // Check a user's privileges. Returns IsAdministrator, IsModerator, error.
-func GetPrivileges(ctx *context.Context, ChatId int64, UserId int) (bool, bool, error) {
-	jsonValue, _ := json.Marshal(GetChatAdministratorsRequest{
+func (c *Client) GetPrivileges(ChatId int64, UserId int) (bool, bool, error) {
+	incoming := &GetChatAdministratorsResponse{}
+	err := c.Call("getChatAdministrators", GetChatAdministratorsRequest{
 		ChatId: ChatId,
-	})
-
-	m, err := http.Post(defaults.TelegramAPIBase+ctx.Cfg.TelegramToken+"/getChatAdministrators", defaults.ContentType, bytes.NewBuffer(jsonValue))
-	if err != nil {
-		log.Printf("[error] Telegram API response: %v", err)
-		return false, false, err
+	}, incoming)
+	if err == nil {
+		err = incoming.Err()
 	}
-
-	incoming := &GetChatAdministratorsResponse{}
-	err = json.NewDecoder(m.Body).Decode(incoming)
 	if err != nil {
-		log.Printf("[error] GetPrivileges decoder: %v", err)
+		log.Printf("[error] GetPrivileges: %v", err)
 		return false, false, err
 	}
 
@@ -490,37 +676,45 @@ func GetPrivileges(ctx *context.Context, ChatId int64, UserId int) (bool, bool,
 	return false, false, nil
 }
 
-// Retrieves the user details of a member of a supergroup based on user ID.
-func GetChatMember(ctx *context.Context, ChatId int64, UserId int) (*ChatMember, error) {
-	jsonValue, _ := json.Marshal(GetChatMemberRequest{
-		ChatId: ChatId,
-		UserId: UserId,
-	})
-
-	m, err := http.Post(defaults.TelegramAPIBase+ctx.Cfg.TelegramToken+"/getChatMember", defaults.ContentType, bytes.NewBuffer(jsonValue))
+// Retrieves the details of a chat, including the default permissions of its members.
+func (c *Client) GetChat(ChatId int64) (*Chat, error) {
+	incoming := &GetChatResponse{}
+	err := c.Call("getChat", GetChatRequest{ChatId: ChatId}, incoming)
+	if err == nil {
+		err = incoming.Err()
+	}
 	if err != nil {
-		log.Printf("[error] Telegram API response: %v", err)
+		log.Printf("[error] GetChat: %d, %v", ChatId, err)
 		return nil, err
 	}
 
+	return incoming.Result, nil
+}
+
+// Retrieves the user details of a member of a supergroup based on user ID.
+func (c *Client) GetChatMember(ChatId int64, UserId int) (*ChatMember, error) {
 	incoming := &GetChatMemberResponse{}
-	err = json.NewDecoder(m.Body).Decode(incoming)
+	err := c.Call("getChatMember", GetChatMemberRequest{
+		ChatId: ChatId,
+		UserId: UserId,
+	}, incoming)
 	if err != nil {
-		log.Printf("[error] GetChatMember decoder: %v", err)
+		log.Printf("[error] GetChatMember: %v", err)
 		return nil, err
 	}
 
-	if incoming.Ok {
-		return incoming.Result, nil
+	if err = incoming.Err(); err != nil {
+		return nil, err
 	}
 
-	return nil, errors.New(fmt.Sprintf("(%d) %s", incoming.ErrorCode, incoming.Description))
+	return incoming.Result, nil
 }
 
 // Add moderators to a supergroup.
-func AddModerator(ctx *context.Context, ChatId int64, Users []*User) (result []string, errors []string) {
+func (c *Client) AddModerator(ChatId int64, Users []*User) (result []string, errors []string) {
 	for _, user := range Users {
-		jsonValue, _ := json.Marshal(PromoteChatMemberRequest{
+		incoming := &PromoteChatMemberResponse{}
+		err := c.Call("promoteChatMember", PromoteChatMemberRequest{
 			ChatId:             ChatId,
 			UserId:             user.Id,
 			CanChangeInfo:      false,
@@ -531,36 +725,27 @@ func AddModerator(ctx *context.Context, ChatId int64, Users []*User) (result []s
 			CanRestrictMembers: false,
 			CanPinMessages:     true,
 			CanPromoteMembers:  false,
-		})
-
-		m, err := http.Post(defaults.TelegramAPIBase+ctx.Cfg.TelegramToken+"/promoteChatMember", defaults.ContentType, bytes.NewBuffer(jsonValue))
-		if err != nil {
-			log.Printf("[error] Telegram API response: %+v, %+v", user, err)
-			continue
+		}, incoming)
+		if err == nil {
+			err = incoming.Err()
 		}
-
-		incoming := &PromoteChatMemberResponse{}
-		err = json.NewDecoder(m.Body).Decode(incoming)
 		if err != nil {
-			log.Printf("[error] AddModerator decoder: %+v, %+v", user, err)
+			log.Printf("[error] AddModerator: %+v, %+v", user, err)
+			errors = append(errors, failure(user, err))
 			continue
 		}
 
-		if incoming.Ok {
-			result = append(result, fmt.Sprintf("[%s](tg://user?id=%d)", user.String(), user.Id))
-		} else {
-			log.Printf("[error] AddModerator response: %d, %s, %+v", incoming.ErrorCode, incoming.Description, user)
-			errors = append(errors, fmt.Sprintf("%s (%s %s): %d: %s", user.Username, user.FirstName, user.LastName, incoming.ErrorCode, incoming.Description))
-		}
+		result = append(result, fmt.Sprintf("[%s](tg://user?id=%d)", user.String(), user.Id))
 	}
 
 	return
 }
 
 // Remove moderators from a supergroup.
-func RemoveModerator(ctx *context.Context, ChatId int64, Users []*User) (result []string, errors []string) {
+func (c *Client) RemoveModerator(ChatId int64, Users []*User) (result []string, errors []string) {
 	for _, user := range Users {
-		jsonValue, _ := json.Marshal(PromoteChatMemberRequest{
+		incoming := &PromoteChatMemberResponse{}
+		err := c.Call("promoteChatMember", PromoteChatMemberRequest{
 			ChatId:             ChatId,
 			UserId:             user.Id,
 			CanChangeInfo:      false,
@@ -571,132 +756,144 @@ func RemoveModerator(ctx *context.Context, ChatId int64, Users []*User) (result
 			CanRestrictMembers: false,
 			CanPinMessages:     false,
 			CanPromoteMembers:  false,
-		})
-
-		m, err := http.Post(defaults.TelegramAPIBase+ctx.Cfg.TelegramToken+"/promoteChatMember", defaults.ContentType, bytes.NewBuffer(jsonValue))
-		if err != nil {
-			log.Printf("[error] Telegram API response: %+v, %+v", user, err)
-			continue
+		}, incoming)
+		if err == nil {
+			err = incoming.Err()
 		}
-
-		incoming := &PromoteChatMemberResponse{}
-		err = json.NewDecoder(m.Body).Decode(incoming)
 		if err != nil {
-			log.Printf("[error] RemoveModerator decoder: %+v, %+v", user, err)
+			log.Printf("[error] RemoveModerator: %+v, %+v", user, err)
+			errors = append(errors, failure(user, err))
 			continue
 		}
 
-		if incoming.Ok {
-			result = append(result, fmt.Sprintf("[%s](tg://user?id=%d)", user.String(), user.Id))
-		} else {
-			log.Printf("[error] RemoveModerator response: %d, %s, %+v", incoming.ErrorCode, incoming.Description, user)
-			errors = append(errors, fmt.Sprintf("%s (%s %s): %d: %s", user.Username, user.FirstName, user.LastName, incoming.ErrorCode, incoming.Description))
-		}
+		result = append(result, fmt.Sprintf("[%s](tg://user?id=%d)", user.String(), user.Id))
 	}
 
 	return
 }
 
-// Ban members of a supergroup.
-func BanMember(ctx *context.Context, ChatId int64, Users []*User) (result []string) {
+// Ban members of a supergroup until the given time. UntilDate 0 bans them forever. The reason is logged with each ban.
+func (c *Client) BanMember(ChatId int64, Users []*User, UntilDate int64, Reason string) (result []string, errors []string) {
 	for _, user := range Users {
-		jsonValue, _ := json.Marshal(KickChatMemberRequest{
-			ChatId: ChatId,
-			UserId: user.Id,
-		})
-
-		m, err := http.Post(defaults.TelegramAPIBase+ctx.Cfg.TelegramToken+"/kickChatMember", defaults.ContentType, bytes.NewBuffer(jsonValue))
-		if err != nil {
-			log.Printf("[error] Telegram API response: %+v, %+v", user, err)
-			continue
-		}
-
 		incoming := &KickChatMemberResponse{}
-		err = json.NewDecoder(m.Body).Decode(incoming)
+		err := c.Call("kickChatMember", KickChatMemberRequest{
+			ChatId:    ChatId,
+			UserId:    user.Id,
+			UntilDate: UntilDate,
+		}, incoming)
+		if err == nil {
+			err = incoming.Err()
+		}
 		if err != nil {
-			log.Printf("[error] BanMember decoder: %+v, %+v", user, err)
+			log.Printf("[error] BanMember: %+v, %+v", user, err)
+			errors = append(errors, failure(user, err))
 			continue
 		}
 
-		if incoming.Ok {
-			result = append(result, fmt.Sprintf("[%s](tg://user?id=%d)", user.String(), user.Id))
-		} else {
-			log.Printf("[error] BanMember response: %d, %s, %+v", incoming.ErrorCode, incoming.Description, user)
-		}
+		log.Printf("[info] Banned %+v in %d until %d. Reason: %s", user, ChatId, UntilDate, Reason)
+		result = append(result, fmt.Sprintf("[%s](tg://user?id=%d)", user.String(), user.Id))
 	}
 
 	return
 }
 
-// Unban members from a supergroup..
-func UnbanMember(ctx *context.Context, ChatId int64, Users []*User) (result []string) {
+// Mute members of a supergroup until the given time. UntilDate 0 mutes them forever. The reason is logged with each mute.
+func (c *Client) MuteMember(ChatId int64, Users []*User, UntilDate int64, Reason string) (result []string, errors []string) {
 	for _, user := range Users {
-		jsonValue, _ := json.Marshal(KickChatMemberRequest{
-			ChatId: ChatId,
-			UserId: user.Id,
-		})
-
-		m, err := http.Post(defaults.TelegramAPIBase+ctx.Cfg.TelegramToken+"/unbanChatMember", defaults.ContentType, bytes.NewBuffer(jsonValue))
+		incoming := &RestrictChatMemberResponse{}
+		err := c.Call("restrictChatMember", RestrictChatMemberRequest{
+			ChatId:      ChatId,
+			UserId:      user.Id,
+			Permissions: &ChatPermissions{},
+			UntilDate:   UntilDate,
+		}, incoming)
+		if err == nil {
+			err = incoming.Err()
+		}
 		if err != nil {
-			log.Printf("[error] Telegram API response: %+v, %+v", user, err)
+			log.Printf("[error] MuteMember: %+v, %+v", user, err)
+			errors = append(errors, failure(user, err))
 			continue
 		}
 
-		incoming := &KickChatMemberResponse{}
-		err = json.NewDecoder(m.Body).Decode(incoming)
+		log.Printf("[info] Muted %+v in %d until %d. Reason: %s", user, ChatId, UntilDate, Reason)
+		result = append(result, fmt.Sprintf("[%s](tg://user?id=%d)", user.String(), user.Id))
+	}
+
+	return
+}
+
+// Unmute members of a supergroup.
+func (c *Client) UnmuteMember(ChatId int64, Users []*User) (result []string, errors []string) {
+	chat, err := c.GetChat(ChatId)
+	if err != nil {
+		for _, user := range Users {
+			errors = append(errors, failure(user, err))
+		}
+		return
+	}
+	// Unmuted users get the default permissions of the chat, not more.
+	permissions := chat.Permissions
+	if permissions == nil {
+		permissions = &ChatPermissions{CanSendMessages: true}
+	}
+
+	for _, user := range Users {
+		incoming := &RestrictChatMemberResponse{}
+		err := c.Call("restrictChatMember", RestrictChatMemberRequest{
+			ChatId:      ChatId,
+			UserId:      user.Id,
+			Permissions: permissions,
+		}, incoming)
+		if err == nil {
+			err = incoming.Err()
+		}
 		if err != nil {
-			log.Printf("[error] UnbanMember decoder: %+v, %+v", user, err)
+			log.Printf("[error] UnmuteMember: %+v, %+v", user, err)
+			errors = append(errors, failure(user, err))
 			continue
 		}
 
-		if incoming.Ok {
-			result = append(result, fmt.Sprintf("[%s](tg://user?id=%d)", user.String(), user.Id))
-			_ = db.ResetUserWarn(ctx, user.Id)
-		} else {
-			log.Printf("[error] UnbanMember response: %d, %s, %+v", incoming.ErrorCode, incoming.Description, user)
-		}
+		result = append(result, fmt.Sprintf("[%s](tg://user?id=%d)", user.String(), user.Id))
 	}
 
 	return
 }
 
-// Warn members of a supergroup.
-func WarnMember(ctx *context.Context, ChatId int64, Users []*User) (warned, banned []string) {
-	var BanMembers []*User
+// Unban members from a supergroup.
+func (c *Client) UnbanMember(ChatId int64, Users []*User) (result []string, errors []string) {
 	for _, user := range Users {
-		warn, err := db.AddWarnToUser(ctx, user.Id)
+		incoming := &KickChatMemberResponse{}
+		err := c.Call("unbanChatMember", KickChatMemberRequest{
+			ChatId: ChatId,
+			UserId: user.Id,
+		}, incoming)
+		if err == nil {
+			err = incoming.Err()
+		}
 		if err != nil {
-			if defaults.Debug {
-				log.Printf("[debug] [error] WarnMember AddWarnToUser error %+v", err.Error())
-			}
+			log.Printf("[error] UnbanMember: %+v, %+v", user, err)
+			errors = append(errors, failure(user, err))
 			continue
 		}
-		if warn >= defaults.WarnLimit {
-			BanMembers = append(BanMembers, user)
-		} else {
-			warned = append(warned, fmt.Sprintf("[%s](tg://user?id=%d)", user.String(), user.Id))
-		}
+
+		result = append(result, fmt.Sprintf("[%s](tg://user?id=%d)", user.String(), user.Id))
 	}
-	banned = BanMember(ctx, ChatId, BanMembers)
+
 	return
 }
 
 // List moderators in a supergroup.
-func ListModerators(ctx *context.Context, ChatId int64) (result []string) {
-	jsonValue, _ := json.Marshal(GetChatAdministratorsRequest{
+func (c *Client) ListModerators(ChatId int64) (result []string) {
+	incoming := &GetChatAdministratorsResponse{}
+	err := c.Call("getChatAdministrators", GetChatAdministratorsRequest{
 		ChatId: ChatId,
-	})
-
-	m, err := http.Post(defaults.TelegramAPIBase+ctx.Cfg.TelegramToken+"/getChatAdministrators", defaults.ContentType, bytes.NewBuffer(jsonValue))
-	if err != nil {
-		log.Printf("[error] Telegram API response: %v", err)
-		return
+	}, incoming)
+	if err == nil {
+		err = incoming.Err()
 	}
-
-	incoming := &GetChatAdministratorsResponse{}
-	err = json.NewDecoder(m.Body).Decode(incoming)
 	if err != nil {
-		log.Printf("[error] ListModerators decoder: %v", err)
+		log.Printf("[error] ListModerators: %v", err)
 		return
 	}
 
@@ -709,3 +906,200 @@ func ListModerators(ctx *context.Context, ChatId int64) (result []string) {
 
 	return
 }
+
+// Answer a button click. The Text is shown to the user as a notification, or as an alert if ShowAlert is set.
+func (c *Client) AnswerCallbackQuery(CallbackQueryId string, Text string, ShowAlert bool) error {
+	incoming := &AnswerCallbackQueryResponse{}
+	err := c.Call("answerCallbackQuery", AnswerCallbackQueryRequest{
+		CallbackQueryId: CallbackQueryId,
+		Text:            Text,
+		ShowAlert:       ShowAlert,
+	}, incoming)
+	if err == nil {
+		err = incoming.Err()
+	}
+	if err != nil {
+		log.Printf("[error] AnswerCallbackQuery: %v", err)
+	}
+	return err
+}
+
+// Change the text and the inline keyboard of a message that the bot sent. A nil Keyboard removes the buttons.
+// The Text is sent without formatting.
+func (c *Client) EditMessageText(ChatId int64, MessageId int64, Text string, Keyboard *InlineKeyboardMarkup) error {
+	incoming := &EditMessageTextResponse{}
+	err := c.Call("editMessageText", EditMessageTextRequest{
+		ChatId:      ChatId,
+		MessageId:   MessageId,
+		Text:        Text,
+		ReplyMarkup: Keyboard,
+	}, incoming)
+	if err == nil {
+		err = incoming.Err()
+	}
+	if err != nil {
+		log.Printf("[error] EditMessageText: %v", err)
+	}
+	return err
+}
+
+// Delete a message of a chat.
+func (c *Client) DeleteMessage(ChatId int64, MessageId int64) error {
+	incoming := &DeleteMessageResponse{}
+	err := c.Call("deleteMessage", DeleteMessageRequest{
+		ChatId:    ChatId,
+		MessageId: MessageId,
+	}, incoming)
+	if err == nil {
+		err = incoming.Err()
+	}
+	if err != nil {
+		log.Printf("[error] DeleteMessage: %d, %d, %v", ChatId, MessageId, err)
+		return err
+	}
+
+	log.Printf("[info] Deleted message %d in %d.", MessageId, ChatId)
+	return nil
+}
+
+// Delete messages of a chat, in batches of defaults.TelegramDeleteMessagesLimit. Telegram skips the messages that
+// do not exist or can not be deleted anymore. Stops at the first failed batch.
+func (c *Client) DeleteMessages(ChatId int64, MessageIds []int64) error {
+	for start := 0; start < len(MessageIds); start += defaults.TelegramDeleteMessagesLimit {
+		end := start + defaults.TelegramDeleteMessagesLimit
+		if end > len(MessageIds) {
+			end = len(MessageIds)
+		}
+		incoming := &DeleteMessagesResponse{}
+		err := c.Call("deleteMessages", DeleteMessagesRequest{
+			ChatId:     ChatId,
+			MessageIds: MessageIds[start:end],
+		}, incoming)
+		if err == nil {
+			err = incoming.Err()
+		}
+		if err != nil {
+			log.Printf("[error] DeleteMessages: %d, %v", ChatId, err)
+			return err
+		}
+	}
+
+	log.Printf("[info] Deleted %d message(s) in %d.", len(MessageIds), ChatId)
+	return nil
+}
+
+// Set the command menu of the bot for a scope and a language. An empty LanguageCode sets the menu for the users
+// whose language has no menu of its own.
+func (c *Client) SetMyCommands(Commands []BotCommand, Scope *BotCommandScope, LanguageCode string) error {
+	incoming := &SetMyCommandsResponse{}
+	err := c.Call("setMyCommands", SetMyCommandsRequest{
+		Commands:     Commands,
+		Scope:        Scope,
+		LanguageCode: LanguageCode,
+	}, incoming)
+	if err == nil {
+		err = incoming.Err()
+	}
+	if err != nil {
+		log.Printf("[error] SetMyCommands: %+v, %q, %v", Scope, LanguageCode, err)
+	}
+	return err
+}
+
+// Remove the command menu of the bot for a scope and a language.
+func (c *Client) DeleteMyCommands(Scope *BotCommandScope, LanguageCode string) error {
+	incoming := &DeleteMyCommandsResponse{}
+	err := c.Call("deleteMyCommands", DeleteMyCommandsRequest{
+		Scope:        Scope,
+		LanguageCode: LanguageCode,
+	}, incoming)
+	if err == nil {
+		err = incoming.Err()
+	}
+	if err != nil {
+		log.Printf("[error] DeleteMyCommands: %+v, %q, %v", Scope, LanguageCode, err)
+	}
+	return err
+}
+
+// Get the updates after Offset with long polling. Timeout is the number of seconds Telegram waits for an update.
+// The HTTP client of the Client has to wait longer than that. Only the AllowedUpdates types are returned.
+func (c *Client) GetUpdates(Offset int, Timeout int, AllowedUpdates []string) ([]*Update, error) {
+	incoming := &GetUpdatesResponse{}
+	err := c.Call("getUpdates", GetUpdatesRequest{
+		Offset:         Offset,
+		Timeout:        Timeout,
+		AllowedUpdates: AllowedUpdates,
+	}, incoming)
+	if err == nil {
+		err = incoming.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return incoming.Result, nil
+}
+
+// Tell Telegram to send the AllowedUpdates types of updates to Url. Telegram sends SecretToken with each request, if set.
+func (c *Client) SetWebhook(Url string, SecretToken string, AllowedUpdates []string, MaxConnections int) error {
+	incoming := &WebhookResponse{}
+	err := c.Call("setWebhook", SetWebhookRequest{
+		Url:            Url,
+		MaxConnections: MaxConnections,
+		AllowedUpdates: AllowedUpdates,
+		SecretToken:    SecretToken,
+	}, incoming)
+	if err == nil {
+		err = incoming.Err()
+	}
+	return err
+}
+
+// Remove the webhook, so the updates can be polled.
+func (c *Client) DeleteWebhook() error {
+	incoming := &WebhookResponse{}
+	err := c.Call("deleteWebhook", EmptyRequest{}, incoming)
+	if err == nil {
+		err = incoming.Err()
+	}
+	return err
+}
+
+// Get the current webhook settings and status.
+func (c *Client) GetWebhookInfo() (*WebhookInfo, error) {
+	incoming := &GetWebhookInfoResponse{}
+	err := c.Call("getWebhookInfo", EmptyRequest{}, incoming)
+	if err == nil {
+		err = incoming.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return incoming.Result, nil
+}
+
+// Get the bot's own user details.
+func (c *Client) GetMe() (*User, error) {
+	incoming := &GetMeResponse{}
+	err := c.Call("getMe", EmptyRequest{}, incoming)
+	if err == nil {
+		err = incoming.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return incoming.Result, nil
+}
+
+// Format a Unix timestamp for messages.
+func FormatDate(Date int64) string {
+	return time.Unix(Date, 0).UTC().Format("2006-01-02 15:04 UTC")
+}
+
+// Escape the characters that have a meaning in Telegram's Markdown, so user input is displayed as-is.
+func EscapeMarkdown(Text string) string {
+	return markdownEscaper.Replace(Text)
+}
@@ -0,0 +1,83 @@
+package telegram
+
+import (
+	"sync"
+	"time"
+)
+
+// Throttle limits the rate of outgoing messages per chat and globally, using a sliding window.
+type Throttle struct {
+	mutex sync.Mutex
+
+	// Send times within the window, oldest first
+	chats  map[int64][]time.Time
+	global []time.Time
+
+	// At most ChatLimit messages are sent to a chat in ChatWindow
+	ChatLimit  int
+	ChatWindow time.Duration
+
+	// At most GlobalLimit messages are sent in GlobalWindow
+	GlobalLimit  int
+	GlobalWindow time.Duration
+}
+
+// NewThrottle creates a Throttle with the given limits.
+func NewThrottle(ChatLimit int, ChatWindow time.Duration, GlobalLimit int, GlobalWindow time.Duration) *Throttle {
+	return &Throttle{
+		chats:        make(map[int64][]time.Time),
+		ChatLimit:    ChatLimit,
+		ChatWindow:   ChatWindow,
+		GlobalLimit:  GlobalLimit,
+		GlobalWindow: GlobalWindow,
+	}
+}
+
+// Wait blocks until a message can be sent to the chat and records the send.
+// It returns false without recording the send if the message could not be sent within MaxWait.
+func (t *Throttle) Wait(ChatId int64, MaxWait time.Duration) bool {
+	deadline := time.Now().Add(MaxWait)
+	for {
+		t.mutex.Lock()
+		now := time.Now()
+		t.global = pruneSendTimes(t.global, now.Add(-t.GlobalWindow))
+		chat := pruneSendTimes(t.chats[ChatId], now.Add(-t.ChatWindow))
+
+		var wait time.Duration
+		if len(t.global) >= t.GlobalLimit {
+			wait = t.global[0].Add(t.GlobalWindow).Sub(now)
+		}
+		if len(chat) >= t.ChatLimit {
+			if chatWait := chat[0].Add(t.ChatWindow).Sub(now); chatWait > wait {
+				wait = chatWait
+			}
+		}
+
+		if wait <= 0 {
+			t.global = append(t.global, now)
+			t.chats[ChatId] = append(chat, now)
+			t.mutex.Unlock()
+			return true
+		}
+
+		if len(chat) == 0 {
+			delete(t.chats, ChatId)
+		} else {
+			t.chats[ChatId] = chat
+		}
+		t.mutex.Unlock()
+		if now.Add(wait).After(deadline) {
+			return false
+		}
+		time.Sleep(wait)
+	}
+}
+
+// pruneSendTimes drops the send times before the start of the window.
+func pruneSendTimes(times []time.Time, start time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(start) {
+		i++
+	}
+	return times[i:]
+}
@@ -0,0 +1,60 @@
+package main
+
+// Descriptions of the commands in the Telegram command menu, by language code and command name.
+// Commands without a translation use the English description of the command.
+var commandTranslations = map[string]map[string]string{
+	"de": {
+		"/help":     "Zeigt die Befehle an, die du verwenden kannst.",
+		"/ban":      "Einen Benutzer entfernen und sperren.",
+		"/tban":     "Einen Benutzer zeitweise sperren.",
+		"/unban":    "Die Sperre eines Benutzers aufheben.",
+		"/mute":     "Einen Benutzer stummschalten.",
+		"/unmute":   "Die Stummschaltung eines Benutzers aufheben.",
+		"/warn":     "Einen Benutzer verwarnen.",
+		"/warns":    "Die Verwarnungen eines Benutzers anzeigen.",
+		"/whois":    "Aktuelle und frühere Benutzernamen und Namen eines Benutzers anzeigen.",
+		"/del":      "Die beantwortete Nachricht löschen.",
+		"/purge":    "Alle Nachrichten ab der beantworteten Nachricht bis zum Befehl löschen.",
+		"/list":     "Moderatoren auflisten.",
+		"/settings": "Die Einstellungen der Supergruppe anzeigen.",
+		"/promote":  "Einen Benutzer zum Moderator ernennen.",
+		"/demote":   "Einen Moderator zum Benutzer zurückstufen.",
+		"/set":      "Eine Einstellung der Supergruppe ändern.",
+	},
+	"es": {
+		"/help":     "Muestra los comandos que puedes usar.",
+		"/ban":      "Expulsa y banea a un usuario.",
+		"/tban":     "Banea a un usuario por un tiempo.",
+		"/unban":    "Quita el baneo a un usuario.",
+		"/mute":     "Silencia a un usuario.",
+		"/unmute":   "Quita el silencio a un usuario.",
+		"/warn":     "Advierte a un usuario.",
+		"/warns":    "Muestra las advertencias de un usuario.",
+		"/whois":    "Muestra los nombres de usuario y nombres actuales y anteriores de un usuario.",
+		"/del":      "Elimina el mensaje respondido.",
+		"/purge":    "Elimina todos los mensajes desde el mensaje respondido hasta el comando.",
+		"/list":     "Lista los moderadores.",
+		"/settings": "Muestra la configuración del supergrupo.",
+		"/promote":  "Asciende a un usuario a moderador.",
+		"/demote":   "Degrada a un moderador a usuario.",
+		"/set":      "Cambia una configuración del supergrupo.",
+	},
+	"ru": {
+		"/help":     "Показать доступные вам команды.",
+		"/ban":      "Исключить и заблокировать пользователя.",
+		"/tban":     "Временно заблокировать пользователя.",
+		"/unban":    "Разблокировать пользователя.",
+		"/mute":     "Запретить пользователю писать сообщения.",
+		"/unmute":   "Снова разрешить пользователю писать сообщения.",
+		"/warn":     "Выдать предупреждение пользователю.",
+		"/warns":    "Показать предупреждения пользователя.",
+		"/whois":    "Показать текущие и прежние имена пользователя.",
+		"/del":      "Удалить сообщение, на которое дан ответ.",
+		"/purge":    "Удалить все сообщения от отвеченного сообщения до команды.",
+		"/list":     "Показать список модераторов.",
+		"/settings": "Показать настройки супергруппы.",
+		"/promote":  "Назначить пользователя модератором.",
+		"/demote":   "Снять пользователя с должности модератора.",
+		"/set":      "Изменить настройку супергруппы.",
+	},
+}